@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	cheek "github.com/datarootsio/cheek/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	serverURL string
+	token     string
+)
+
+// cancelCmd represents the cancel command
+var cancelCmd = &cobra.Command{
+	Use:   "cancel {job_name} {run_id}",
+	Short: "Cancel a queued or running run of a job",
+	Long: `Cancel a queued or running run of a job.
+
+Asks the cheek that runs the job to stop the run, it finds cheek on this
+host via the same flags and env vars, such as --port and --socket, that it
+was started with. Usage:
+'cheek cancel my_job 42'
+
+Pass --url to reach cheek elsewhere and --token (or set CHEEK_TOKEN) if it
+requires authentication.
+`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := cheek.NewConfig()
+		if err := viper.Unmarshal(&c); err != nil {
+			return err
+		}
+
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("run id '%s' should be a number", args[1])
+		}
+
+		client := cheek.NewClient(c, viper.GetString("url"), viper.GetString("token"))
+		if err := client.CancelRun(args[0], id); err != nil {
+			return err
+		}
+		fmt.Printf("Run %d of job %s cancelled\n", id, args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cancelCmd)
+	cancelCmd.Flags().StringVar(&serverURL, "url", "", "url of the cheek to talk to including its base path, e.g. https://example.com/cheek, defaults to the one on this host")
+	cancelCmd.Flags().StringVar(&token, "token", "", "bearer token to authenticate with, defaults to CHEEK_TOKEN")
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelCmd(t *testing.T) {
+	rootCmd.SetArgs([]string{"cancel", "bar", "latest"})
+	err := rootCmd.Execute()
+	assert.ErrorContains(t, err, "should be a number")
+
+	rootCmd.SetArgs([]string{"cancel", "bar", "1", "--url", "http://127.0.0.1:1"})
+	err = rootCmd.Execute()
+	assert.ErrorContains(t, err, "cannot reach cheek")
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+
+	cheek "github.com/datarootsio/cheek/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	pruneKeepRuns int
+	pruneKeepDays int
+	pruneVacuum   bool
+
+	migrateStatus bool
+	migrateTo     int
+)
+
+// dbCmd groups the commands that manage cheek's db
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage cheek's database",
+	Long:  "Manage cheek's database",
+}
+
+// pruneCmd represents the db prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune {schedule.yaml}",
+	Short: "Delete runs and core logs that fall outside of their retention",
+	Long: `Delete runs and core logs that fall outside of their retention
+
+Applies the retention settings of the schedule, the scheduler does the same
+every hour. Usage:
+'cheek db prune my_schedule.yaml --keep-days 30 --vacuum'
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := cheek.NewConfig()
+		if err := viper.Unmarshal(&c); err != nil {
+			return err
+		}
+		if err := c.Init(); err != nil {
+			return err
+		}
+		defer func() { _ = c.Store.Close() }()
+
+		l := cheek.NewLogger(logLevel, c.Store, cheek.PrettyStdout())
+		override := cheek.Retention{KeepRuns: pruneKeepRuns, KeepDays: pruneKeepDays}
+		return cheek.PruneDB(l, c, args[0], override, pruneVacuum)
+	},
+}
+
+// migrateCmd represents the db migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending migrations to the database schema",
+	Long: `Apply pending migrations to the database schema
+
+cheek applies pending migrations on start, this allows to inspect and apply
+them up front. Usage:
+'cheek db migrate --status'
+'cheek db migrate --to 3'
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := cheek.NewConfig()
+		if err := viper.Unmarshal(&c); err != nil {
+			return err
+		}
+		db, err := cheek.ConnectDB(c.DBPath)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = db.Close() }()
+
+		if !migrateStatus {
+			if err := cheek.MigrateDB(db, migrateTo); err != nil {
+				return err
+			}
+		}
+
+		status, err := cheek.MigrationsStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = fmt.Sprintf("applied at %s", m.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else if m.Applied {
+				applied = "applied before migrations were tracked"
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%04d %-30s %s\n", m.Version, m.Name, applied)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(pruneCmd)
+	dbCmd.AddCommand(migrateCmd)
+	pruneCmd.Flags().IntVar(&pruneKeepRuns, "keep-runs", 0, "Keep this many runs per job, overrides the schedule's global retention.")
+	pruneCmd.Flags().IntVar(&pruneKeepDays, "keep-days", 0, "Keep runs of this many days, overrides the schedule's global retention.")
+	pruneCmd.Flags().BoolVar(&pruneVacuum, "vacuum", false, "Rebuild the db file afterwards to free up disk space.")
+	migrateCmd.Flags().BoolVar(&migrateStatus, "status", false, "Only show which migrations have been applied.")
+	migrateCmd.Flags().IntVar(&migrateTo, "to", 0, "Migrate up to and including this version, defaults to the latest.")
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cheek "github.com/datarootsio/cheek/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// tempDB points the commands at a db in a temp dir, so tests never touch
+// the db in the user's home.
+func tempDB(t *testing.T) string {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "cheek.sqlite3")
+	flags := rootCmd.PersistentFlags()
+	previous, _ := flags.GetString("dbpath")
+	assert.NoError(t, flags.Set("dbpath", fn))
+	t.Cleanup(func() { _ = flags.Set("dbpath", previous) })
+	return fn
+}
+
+// seedDB saves runs in the db at fn.
+func seedDB(t *testing.T, fn string, runs ...*cheek.JobRun) {
+	t.Helper()
+	store, err := cheek.NewStore(cheek.StoreSQLite, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+	for _, jr := range runs {
+		assert.NoError(t, store.SaveJobRun(jr))
+	}
+}
+
+func TestPruneCmd(t *testing.T) {
+	fn := tempDB(t)
+	ok := cheek.StatusOK
+	now := time.Now().UTC().Truncate(time.Second)
+	old := &cheek.JobRun{Name: "bar", TriggeredAt: now.AddDate(-2, 0, 0), TriggeredBy: "cron", Status: &ok}
+	recent := &cheek.JobRun{Name: "bar", TriggeredAt: now.Add(-time.Hour), TriggeredBy: "cron", Status: &ok}
+	seedDB(t, fn, old, recent)
+
+	rootCmd.SetArgs([]string{"db", "prune", "../testdata/jobs1.yaml", "--keep-days", "365"})
+	assert.NoError(t, rootCmd.Execute())
+
+	store, err := cheek.NewStore(cheek.StoreSQLite, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+	runs, err := store.JobRuns("bar", 10, false)
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 1) {
+		assert.Equal(t, recent.LogEntryId, runs[0].LogEntryId)
+	}
+}
+
+func TestMigrateCmd(t *testing.T) {
+	tempDB(t)
+	out := new(bytes.Buffer)
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+
+	rootCmd.SetArgs([]string{"db", "migrate", "--status"})
+	assert.NoError(t, rootCmd.Execute())
+	assert.Contains(t, out.String(), "0001 create_log")
+	assert.NotContains(t, out.String(), "applied")
+
+	out.Reset()
+	migrateStatus = false
+	rootCmd.SetArgs([]string{"db", "migrate", "--to", "1"})
+	assert.NoError(t, rootCmd.Execute())
+	migrateTo = 0
+	assert.Regexp(t, `0001 create_log +applied at `, out.String())
+	assert.Regexp(t, `0002 \w+ +pending`, out.String())
+}
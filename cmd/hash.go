@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// hashPasswordCmd represents the hash-password command
+var hashPasswordCmd = &cobra.Command{
+	Use:   "hash-password",
+	Short: "Hash a password for the auth users of a schedule",
+	Long: `Hash a password for the auth users of a schedule
+
+Reads the password from stdin and prints its bcrypt hash. Usage:
+'echo -n "s3cret" | cheek hash-password'
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// a missing trailing newline is fine, like with echo -n
+		password, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		password = strings.TrimRight(password, "\r\n")
+		if password == "" {
+			return fmt.Errorf("no password given on stdin")
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(hash))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hashPasswordCmd)
+}
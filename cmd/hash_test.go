@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPasswordCmd(t *testing.T) {
+	out := new(bytes.Buffer)
+	rootCmd.SetIn(strings.NewReader("s3cret\n"))
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"hash-password"})
+	assert.NoError(t, rootCmd.Execute())
+
+	hash := strings.TrimSpace(out.String())
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("s3cret")))
+
+	rootCmd.SetIn(strings.NewReader(""))
+	assert.Error(t, rootCmd.Execute())
+}
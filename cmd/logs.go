@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	cheek "github.com/datarootsio/cheek/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	searchJob   string
+	searchSince string
+	searchLimit int
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Inspect the output of past runs",
+}
+
+// logsSearchCmd represents the logs search command
+var logsSearchCmd = &cobra.Command{
+	Use:   "search {query}",
+	Short: "Search the output of past runs",
+	Long: `Search the output of past runs
+
+Lists the runs of which the output contains all words of the query, most
+recent runs first. Usage:
+'cheek logs search "connection refused" --since 7d'
+`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := cheek.NewConfig()
+		if err := viper.Unmarshal(&c); err != nil {
+			return err
+		}
+		if err := c.Init(); err != nil {
+			return err
+		}
+		defer func() { _ = c.Store.Close() }()
+
+		since, err := cheek.ParseTime(searchSince)
+		if err != nil {
+			return err
+		}
+		results, err := c.Store.Search(cheek.SearchQuery{
+			Query: strings.Join(args, " "),
+			Job:   searchJob,
+			Since: since,
+			Limit: searchLimit,
+		})
+		if err != nil {
+			return err
+		}
+
+		// matches are marked for the web UI
+		unmark := strings.NewReplacer("<mark>", "", "</mark>", "")
+		for _, r := range results {
+			status := "running"
+			if r.Status != nil {
+				status = fmt.Sprintf("exit %d", *r.Status)
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s #%d %s by %s (%s)\n", r.Job, r.ID, r.TriggeredAt.Format("2006-01-02 15:04:05"), r.TriggeredBy, status)
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", html.UnescapeString(unmark.Replace(r.Snippet)))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.AddCommand(logsSearchCmd)
+	logsSearchCmd.Flags().StringVar(&searchJob, "job", "", "Only search the runs of this job.")
+	logsSearchCmd.Flags().StringVar(&searchSince, "since", "", "Only search runs since this time, a date, an RFC 3339 time or a duration such as 7d.")
+	logsSearchCmd.Flags().IntVar(&searchLimit, "limit", 50, "Show at most this many runs.")
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	cheek "github.com/datarootsio/cheek/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogsSearchCmd(t *testing.T) {
+	failed := cheek.StatusError
+	now := time.Now().UTC().Truncate(time.Second)
+	old := &cheek.JobRun{Name: "backup", TriggeredAt: now.AddDate(0, 0, -10), TriggeredBy: "cron", Status: &failed, Log: "dial tcp: connection refused"}
+	recent := &cheek.JobRun{Name: "backup", TriggeredAt: now.Add(-time.Hour), TriggeredBy: "cron", Status: &failed, Log: "dial tcp <db>: connection refused"}
+	seedDB(t, tempDB(t), old, recent)
+
+	out := new(bytes.Buffer)
+	rootCmd.SetOut(out)
+	defer rootCmd.SetOut(nil)
+	rootCmd.SetArgs([]string{"logs", "search", "connection refused", "--since", "7d"})
+	assert.NoError(t, rootCmd.Execute())
+	searchSince = ""
+
+	assert.Contains(t, out.String(), fmt.Sprintf("backup #%d ", recent.LogEntryId))
+	assert.Contains(t, out.String(), "(exit -1)")
+	assert.Contains(t, out.String(), "  dial tcp <db>: connection refused\n")
+	assert.NotContains(t, out.String(), fmt.Sprintf("#%d ", old.LogEntryId))
+}
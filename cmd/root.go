@@ -11,9 +11,17 @@ import (
 )
 
 var (
-	httpPort string
-	homeDir  string
-	dbPath   string
+	httpPort    string
+	homeDir     string
+	dbPath      string
+	store       string
+	bind        string
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
+	socket      string
+	socketMode  string
+	basePath    string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -33,6 +41,14 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&httpPort, "port", "8081", "port on which to open the http server for core to ui communication")
 	rootCmd.PersistentFlags().StringVar(&homeDir, "homedir", cheek.CheekPath(), fmt.Sprintf("directory in which to save cheek's core & job logs, defaults to '%s'", cheek.CheekPath()))
 	rootCmd.PersistentFlags().StringVar(&dbPath, "dbpath", path.Join(cheek.CheekPath(), "cheek.sqlite3"), fmt.Sprintf("path to sqlite3 db used for logging, defaults to '%s'", path.Join(cheek.CheekPath(), "cheek.sqlite3")))
+	rootCmd.PersistentFlags().StringVar(&store, "store", cheek.StoreSQLite, fmt.Sprintf("where to keep job runs and core logs, can be one of %s|%s (%s keeps nothing after exiting)", cheek.StoreSQLite, cheek.StoreMemory, cheek.StoreMemory))
+	rootCmd.PersistentFlags().StringVar(&bind, "bind", "", "address on which to open the http server, defaults to all interfaces")
+	rootCmd.PersistentFlags().StringVar(&tlsCert, "tls-cert", "", "certificate file to serve the http server over TLS, reloaded on SIGHUP")
+	rootCmd.PersistentFlags().StringVar(&tlsKey, "tls-key", "", "key file of the TLS certificate, reloaded on SIGHUP")
+	rootCmd.PersistentFlags().StringVar(&tlsClientCA, "tls-client-ca", "", "CA certificate file to verify client certificates with, clients without a valid certificate are turned down")
+	rootCmd.PersistentFlags().StringVar(&socket, "socket", "", "unix domain socket on which to open the http server instead of a port")
+	rootCmd.PersistentFlags().StringVar(&socketMode, "socket-mode", "0660", "file permissions of the unix domain socket")
+	rootCmd.PersistentFlags().StringVar(&basePath, "base-path", "", "path prefix to serve the http server under, e.g. /cheek when proxied from https://example.com/cheek/")
 	cobra.OnInitialize(initConfig)
 }
 
@@ -68,4 +84,30 @@ func initConfig() {
 	if err := viper.BindPFlag("dbpath", rootCmd.PersistentFlags().Lookup("dbpath")); err != nil {
 		fmt.Printf("error binding pflag %s", err)
 	}
+
+	if err := viper.BindPFlag("storeType", rootCmd.PersistentFlags().Lookup("store")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	if err := viper.BindPFlag("url", cancelCmd.Flags().Lookup("url")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	if err := viper.BindPFlag("token", cancelCmd.Flags().Lookup("token")); err != nil {
+		fmt.Printf("error binding pflag %s", err)
+	}
+
+	for key, flag := range map[string]string{
+		"bind":        "bind",
+		"tlsCert":     "tls-cert",
+		"tlsKey":      "tls-key",
+		"tlsClientCA": "tls-client-ca",
+		"socket":      "socket",
+		"socketMode":  "socket-mode",
+		"basePath":    "base-path",
+	} {
+		if err := viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(flag)); err != nil {
+			fmt.Printf("error binding pflag %s", err)
+		}
+	}
 }
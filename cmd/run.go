@@ -33,7 +33,7 @@ var runCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		l := cheek.NewLogger(logLevel, c.DB, cheek.PrettyStdout())
+		l := cheek.NewLogger(logLevel, c.Store, cheek.PrettyStdout())
 		return cheek.RunSchedule(l, c, args[0])
 	},
 }
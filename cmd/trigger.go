@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	cheek "github.com/datarootsio/cheek/pkg"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+var params []string
+
 // triggerCmd represents the trigger command
 var triggerCmd = &cobra.Command{
 	Use:   "trigger {schedule.yaml} {job_name}",
@@ -14,6 +19,9 @@ var triggerCmd = &cobra.Command{
 
 The name should be defined in your schedule specs. Usage:
 'cheek trigger my_schedule.yaml my_job'
+
+Pass values for the params of the job with --param, e.g.
+'cheek trigger my_schedule.yaml backfill --param date=2024-05-01'
 `,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -24,13 +32,24 @@ The name should be defined in your schedule specs. Usage:
 		if err := c.Init(); err != nil {
 			return err
 		}
+		defer func() { _ = c.Store.Close() }()
+
+		values := map[string]string{}
+		for _, p := range params {
+			name, value, ok := strings.Cut(p, "=")
+			if !ok {
+				return fmt.Errorf("param '%s' should be given as name=value", p)
+			}
+			values[name] = value
+		}
 
-		l := cheek.NewLogger(logLevel, c.DB, cheek.PrettyStdout())
-		_, err := cheek.RunJob(l, c, args[0], args[1])
+		l := cheek.NewLogger(logLevel, c.Store, cheek.PrettyStdout())
+		_, err := cheek.RunJob(l, c, args[0], args[1], values)
 		return err
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(triggerCmd)
+	triggerCmd.Flags().StringArrayVar(&params, "param", nil, "value of a param of the job as name=value, can be repeated")
 }
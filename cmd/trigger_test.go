@@ -11,3 +11,15 @@ func TestTriggerCmd(t *testing.T) {
 	err := rootCmd.Execute()
 	assert.NoError(t, err)
 }
+
+func TestTriggerCmdParams(t *testing.T) {
+	rootCmd.SetArgs([]string{"trigger", "../testdata/jobs1.yaml", "bar", "--param", "date"})
+	err := rootCmd.Execute()
+	assert.ErrorContains(t, err, "name=value")
+
+	params = nil
+	rootCmd.SetArgs([]string{"trigger", "../testdata/jobs1.yaml", "bar", "--param", "date=2024-05-01"})
+	err = rootCmd.Execute()
+	assert.ErrorContains(t, err, "takes no params")
+	params = nil
+}
@@ -0,0 +1,142 @@
+package cheek
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authRealm is the realm browsers show when asking for credentials.
+const authRealm = "cheek"
+
+// dummyHash gets compared against for unknown users, so that it takes as
+// long to turn down an unknown user as it takes to turn down a wrong password.
+// It's generated on first use as bcrypt is slow on purpose.
+var dummyHash = sync.OnceValues(func() ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte("cheek"), bcrypt.DefaultCost)
+})
+
+// Auth defines who gets to use the web UI and API. Users log in with HTTP
+// basic auth and are mapped to the bcrypt hash of their password, tokens
+// are sent by scripts as bearer tokens. If there are neither users nor
+// tokens, no authentication is required.
+type Auth struct {
+	Users  map[string]string `yaml:"users,omitempty"`
+	Tokens []string          `yaml:"tokens,omitempty"`
+	// PublicMetrics leaves /metrics open for scrapers
+	PublicMetrics bool `yaml:"public_metrics,omitempty"`
+}
+
+func (a Auth) enabled() bool {
+	return len(a.Users) > 0 || len(a.Tokens) > 0
+}
+
+func (a Auth) validate() error {
+	for user, hash := range a.Users {
+		if user == "" || strings.Contains(user, ":") {
+			return fmt.Errorf("user name '%s' should be non-empty and cannot contain ':'", user)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("password of user '%s' is not a bcrypt hash: %w", user, err)
+		}
+	}
+	for _, token := range a.Tokens {
+		if strings.TrimSpace(token) == "" {
+			return fmt.Errorf("tokens cannot be empty")
+		}
+	}
+	return nil
+}
+
+// public returns whether a path can be requested without credentials.
+func (a Auth) public(path string) bool {
+	return path == "/healthz/" || (a.PublicMetrics && path == "/metrics")
+}
+
+// authenticator checks the credentials of requests against the auth
+// settings of the schedule.
+type authenticator struct {
+	s *Schedule
+	// verified holds the credentials that matched a bcrypt hash before,
+	// the UI polls the API and bcrypt is slow on purpose
+	verified sync.Map
+}
+
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := a.s.auth()
+		if !auth.enabled() || auth.public(r.URL.Path) || a.authorized(auth, r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, authRealm))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		status := Response{Status: "error: unauthorized", Type: "auth"}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (a *authenticator) authorized(auth Auth, r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		if validToken(auth.Tokens, token) {
+			return true
+		}
+		a.s.log.Warn().Str("remote_addr", r.RemoteAddr).Str("path", r.URL.Path).Msg("Rejected request with invalid API token")
+		return false
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	if a.validPassword(auth.Users, user, password) {
+		return true
+	}
+	a.s.log.Warn().Str("remote_addr", r.RemoteAddr).Str("path", r.URL.Path).Str("user", user).Msg("Rejected request with invalid credentials")
+	return false
+}
+
+func validToken(tokens []string, token string) bool {
+	valid := false
+	for _, t := range tokens {
+		// compare against all tokens so timing doesn't tell which one matched
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func (a *authenticator) validPassword(users map[string]string, user, password string) bool {
+	hash, ok := users[user]
+	if !ok {
+		if dummy, err := dummyHash(); err != nil {
+			a.s.log.Warn().Err(err).Msg("Couldn't generate the hash to check unknown users against.")
+		} else {
+			_ = bcrypt.CompareHashAndPassword(dummy, []byte(password))
+		}
+		return false
+	}
+
+	// the hash is part of the key, so changing a password on reload
+	// doesn't leave the old one working
+	key := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + hash))
+	if _, ok := a.verified.Load(key); ok {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+	a.verified.Store(key, struct{}{})
+	return true
+}
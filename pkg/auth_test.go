@@ -0,0 +1,85 @@
+package cheek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	s := &Schedule{Jobs: map[string]*JobSpec{"backup": {Name: "backup", cfg: cfg}}, cfg: cfg, log: zerolog.Nop()}
+	router := setupRouter(s)
+
+	get := func(path string, auth func(r *http.Request)) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if auth != nil {
+			auth(req)
+		}
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	basic := func(user, password string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(user, password) }
+	}
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	// no users nor tokens, no auth
+	assert.Equal(t, http.StatusOK, get("/api/jobs", nil).Code)
+
+	s.Auth = Auth{Users: map[string]string{"admin": string(hash)}, Tokens: []string{"ci-token"}}
+	resp := get("/api/jobs", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Header().Get("WWW-Authenticate"), `Basic realm="cheek"`)
+	assert.Equal(t, http.StatusUnauthorized, get("/", nil).Code)
+
+	assert.Equal(t, http.StatusOK, get("/api/jobs", basic("admin", "s3cret")).Code)
+	assert.Equal(t, http.StatusOK, get("/api/jobs", basic("admin", "s3cret")).Code) // verified before
+	assert.Equal(t, http.StatusUnauthorized, get("/api/jobs", basic("admin", "wrong")).Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/api/jobs", basic("nobody", "s3cret")).Code)
+	assert.Equal(t, http.StatusOK, get("/api/jobs", bearer("ci-token")).Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/api/jobs", bearer("ci-tok")).Code)
+
+	assert.Equal(t, http.StatusOK, get("/healthz/", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/metrics", nil).Code)
+	s.Auth.PublicMetrics = true
+	assert.Equal(t, http.StatusOK, get("/metrics", nil).Code)
+
+	// a changed password takes effect right away
+	other, _ := bcrypt.GenerateFromPassword([]byte("other"), bcrypt.MinCost)
+	s.Auth.Users["admin"] = string(other)
+	assert.Equal(t, http.StatusUnauthorized, get("/api/jobs", basic("admin", "s3cret")).Code)
+	assert.Equal(t, http.StatusOK, get("/api/jobs", basic("admin", "other")).Code)
+}
+
+func TestAuthValidation(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	assert.NoError(t, Auth{Users: map[string]string{"admin": string(hash)}, Tokens: []string{"abc"}}.validate())
+	assert.Error(t, Auth{Users: map[string]string{"admin": "s3cret"}}.validate())
+	assert.Error(t, Auth{Users: map[string]string{"ad:min": string(hash)}}.validate())
+	assert.Error(t, Auth{Tokens: []string{" "}}.validate())
+
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, `
+auth:
+  users:
+    admin: plain
+jobs:
+  ok:
+    command: "true"
+`)
+	_, err := loadSchedule(NewLogger("debug", nil, new(tsBuffer)), NewConfig(), fn)
+	assert.ErrorContains(t, err, "auth: password of user 'admin' is not a bcrypt hash")
+}
@@ -0,0 +1,68 @@
+package cheek
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// basePathKey is the request context key of the path the UI is served under.
+type basePathKey struct{}
+
+// validPrefix matches the path prefixes that are safe to use in links.
+var validPrefix = regexp.MustCompile(`^(/[A-Za-z0-9._~%-]+)*$`)
+
+// normalizeBasePath turns a base path into the form '/cheek', without a
+// trailing slash, or an empty string when served at the root.
+func normalizeBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// withBasePath serves the UI and API under basePath. Requests outside of
+// it are not found. Proxies that strip a prefix of their own before
+// passing requests on can tell it with the X-Forwarded-Prefix header,
+// which then gets prepended to the links of the UI.
+func withBasePath(basePath string, next http.Handler) http.Handler {
+	basePath = normalizeBasePath(basePath)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if basePath != "" {
+			if r.URL.Path == basePath {
+				http.Redirect(w, r, forwardedPrefix(r)+basePath+"/", http.StatusMovedPermanently)
+				return
+			}
+			rest, ok := strings.CutPrefix(r.URL.Path, basePath+"/")
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/" + rest
+			r2.URL.RawPath = ""
+			r = r2
+		}
+
+		ctx := context.WithValue(r.Context(), basePathKey{}, forwardedPrefix(r)+basePath)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// forwardedPrefix returns the prefix a proxy stripped from the request,
+// ignoring prefixes that aren't plain paths.
+func forwardedPrefix(r *http.Request) string {
+	prefix := normalizeBasePath(r.Header.Get("X-Forwarded-Prefix"))
+	if !validPrefix.MatchString(prefix) {
+		return ""
+	}
+	return prefix
+}
+
+// requestBasePath returns the path the UI is served under for a request.
+func requestBasePath(r *http.Request) string {
+	p, _ := r.Context().Value(basePathKey{}).(string)
+	return p
+}
@@ -0,0 +1,83 @@
+package cheek
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeBasePath(t *testing.T) {
+	for in, want := range map[string]string{"": "", "/": "", "cheek": "/cheek", "/cheek/": "/cheek", "/ops/cheek": "/ops/cheek"} {
+		assert.Equal(t, want, normalizeBasePath(in), in)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	cfg.BasePath = "/cheek/"
+	s := &Schedule{Jobs: map[string]*JobSpec{"backup": {Name: "backup", cfg: cfg}}, cfg: cfg, log: zerolog.Nop()}
+	router := setupRouter(s)
+
+	get := func(path string, prefix string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if prefix != "" {
+			req.Header.Set("X-Forwarded-Prefix", prefix)
+		}
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// links to the server itself that don't start with the base path
+	unprefixed := regexp.MustCompile(`(href|src|action)="/(?:[^/c]|c[^h])`)
+	for _, path := range []string{"/cheek/", "/cheek/jobs/backup/latest", "/cheek/core/logs", "/cheek/search?q=x"} {
+		resp := get(path, "")
+		assert.Equal(t, http.StatusOK, resp.Code, path)
+		body := resp.Body.String()
+		assert.Contains(t, body, `href="/cheek/static/styles.css"`, path)
+		assert.Contains(t, body, `src="/cheek/static/script.js"`, path)
+		assert.Contains(t, body, `const basePath = "/cheek";`, path)
+		assert.NotRegexp(t, unprefixed, body, path)
+	}
+
+	for _, path := range []string{"/cheek/static/script.js", "/cheek/api/jobs", "/cheek/api/jobs/backup", "/cheek/healthz/"} {
+		assert.Equal(t, http.StatusOK, get(path, "").Code, path)
+	}
+	for _, path := range []string{"/", "/api/jobs", "/cheeky/api/jobs"} {
+		assert.Equal(t, http.StatusNotFound, get(path, "").Code, path)
+	}
+
+	resp := get("/cheek", "")
+	assert.Equal(t, http.StatusMovedPermanently, resp.Code)
+	assert.Equal(t, "/cheek/", resp.Header().Get("Location"))
+
+	// a proxy that strips a prefix of its own
+	body := get("/cheek/", "/ops/").Body.String()
+	assert.Contains(t, body, `href="/ops/cheek/static/styles.css"`)
+	assert.Contains(t, body, `const basePath = "/ops/cheek";`)
+	assert.Equal(t, "/ops/cheek/", get("/cheek", "/ops").Header().Get("Location"))
+
+	// prefixes that aren't plain paths are ignored
+	body = get("/cheek/", `/"><script>alert(1)</script>`).Body.String()
+	assert.Contains(t, body, `href="/cheek/static/styles.css"`)
+	assert.NotContains(t, body, "alert")
+}
+
+func TestForwardedPrefix(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	s := &Schedule{Jobs: map[string]*JobSpec{}, cfg: cfg, log: zerolog.Nop()}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-Prefix", "/cheek")
+	setupRouter(s).ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `href="/cheek/static/styles.css"`)
+	assert.Contains(t, resp.Body.String(), `action="/cheek/search"`)
+}
@@ -0,0 +1,97 @@
+package cheek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// activeRun is a run that is queued or executing and can be cancelled.
+type activeRun struct {
+	job    string
+	cancel context.CancelCauseFunc
+}
+
+// activeRuns keeps track of the runs of a schedule that can be cancelled,
+// by their id. It outlives schedule reloads, like the runs themselves.
+type activeRuns struct {
+	mu   sync.Mutex
+	runs map[int]activeRun
+}
+
+func (a *activeRuns) add(jr JobRun, cancel context.CancelCauseFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.runs == nil {
+		a.runs = map[int]activeRun{}
+	}
+	a.runs[jr.LogEntryId] = activeRun{job: jr.Name, cancel: cancel}
+}
+
+func (a *activeRuns) remove(id int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.runs, id)
+}
+
+// cancel cancels an active run of a job, it returns false if the
+// run is not active (anymore).
+func (a *activeRuns) cancel(jobName string, id int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r, ok := a.runs[id]
+	if !ok || r.job != jobName {
+		return false
+	}
+	r.cancel(errJobCancelled)
+	return true
+}
+
+// track registers a run so it can be cancelled until it is done, the
+// returned func unregisters it. Runs without an id can't be looked up.
+func (j *JobSpec) track(jr JobRun, cancel context.CancelCauseFunc) func() {
+	s := j.globalSchedule
+	if s == nil || jr.LogEntryId == 0 {
+		return func() {}
+	}
+	s.active.add(jr, cancel)
+	return func() { s.active.remove(jr.LogEntryId) }
+}
+
+// CancelRun stops an active run of a job: a queued run is taken off the
+// queue, an executing run gets terminated like on a timeout, and pending
+// retries are aborted. The run is stored with status cancelled.
+func (s *Schedule) CancelRun(jobName string, id int) bool {
+	return s.active.cancel(jobName, id)
+}
+
+// cancelStatus returns the status of a run that got interrupted by ctx,
+// runs that got cancelled by hand or replaced by a newer run count as
+// cancelled.
+func cancelStatus(ctx context.Context) int {
+	if cause := context.Cause(ctx); errors.Is(cause, errJobCancelled) || errors.Is(cause, errJobReplaced) {
+		return StatusCancelled
+	}
+	return StatusError
+}
+
+// stopWaiting records a run that stopped waiting for its turn, either
+// because it got cancelled or because the scheduler shuts down.
+func (j *JobSpec) stopWaiting(ctx context.Context, jr JobRun, while string) JobRun {
+	if cancelStatus(ctx) != StatusCancelled {
+		return j.skip(jr, fmt.Sprintf("%s while %s", cancelReason(ctx), while))
+	}
+	reason := "Run cancelled"
+	if !errors.Is(context.Cause(ctx), errJobCancelled) {
+		reason += " due to " + cancelReason(ctx)
+	}
+	reason += " while " + while
+	j.log.Info().Str("job", j.Name).Str("trigger", jr.TriggeredBy).Msg(reason)
+	status := StatusCancelled
+	jr.Status = &status
+	jr.logBuf.WriteString(reason)
+	jr.flushLogBuffer()
+	jr.save()
+	return jr
+}
@@ -0,0 +1,199 @@
+package cheek
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func cancelSchedule(t *testing.T, spec string) *Schedule {
+	t.Helper()
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, spec)
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	cfg.SuppressLogs = true
+	s, err := loadSchedule(zerolog.Nop(), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func waitForRun(t *testing.T, done <-chan JobRun) JobRun {
+	t.Helper()
+	select {
+	case jr := <-done:
+		return jr
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not stop")
+		return JobRun{}
+	}
+}
+
+func TestCancelRun(t *testing.T) {
+	s := cancelSchedule(t, `
+jobs:
+  slow:
+    command: [sleep, "10"]
+    retries: 3
+    retry_delay: 10ms
+  other:
+    command: [sleep, "10"]
+`)
+	router := setupRouter(s)
+	cancel := func(job string, id int) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/api/jobs/%s/runs/%d/cancel", job, id), nil)
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	j, _ := s.job("slow")
+	jr := j.setup("ui", nil)
+	done := s.launch(j, jr)
+	assert.Eventually(t, func() bool {
+		stored, err := s.cfg.Store.JobRun("slow", jr.LogEntryId)
+		return err == nil && stored.Status == nil
+	}, time.Second, 10*time.Millisecond)
+
+	resp := cancel("slow", jr.LogEntryId)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"type":"cancel"`)
+
+	jr = waitForRun(t, done)
+	assert.Equal(t, StatusCancelled, *jr.Status)
+	assert.NotContains(t, jr.TriggeredBy, "retry")
+
+	stored, err := s.cfg.Store.JobRun("slow", jr.LogEntryId)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCancelled, *stored.Status)
+	page, err := s.cfg.Store.Runs(RunQuery{Status: []string{RunCancelled}})
+	assert.NoError(t, err)
+	assert.Len(t, page.Runs, 1)
+
+	// runs that are done, unknown runs, unknown jobs and runs of another job
+	assert.Equal(t, http.StatusConflict, cancel("slow", jr.LogEntryId).Code)
+	assert.Equal(t, http.StatusNotFound, cancel("slow", 4242).Code)
+	assert.Equal(t, http.StatusNotFound, cancel("unknown", jr.LogEntryId).Code)
+	assert.Equal(t, http.StatusNotFound, cancel("other", jr.LogEntryId).Code)
+
+	other, _ := s.job("other")
+	otherRun := other.setup("ui", nil)
+	otherDone := s.launch(other, otherRun)
+	assert.Eventually(t, func() bool {
+		stored, err := s.cfg.Store.JobRun("other", otherRun.LogEntryId)
+		return err == nil && stored.Status == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, cancel("slow", otherRun.LogEntryId).Code)
+	assert.Equal(t, http.StatusAccepted, cancel("other", otherRun.LogEntryId).Code)
+	assert.Equal(t, StatusCancelled, *waitForRun(t, otherDone).Status)
+}
+
+func TestCancelPendingRetry(t *testing.T) {
+	s := cancelSchedule(t, `
+jobs:
+  flaky:
+    command: [sh, -c, "exit 3"]
+    retries: 3
+    retry_delay: 10s
+`)
+	j, _ := s.job("flaky")
+	jr := j.setup("ui", nil)
+	done := s.launch(j, jr)
+
+	// the first attempt failed and the retry is pending
+	assert.Eventually(t, func() bool {
+		stored, err := s.cfg.Store.JobRun("flaky", jr.LogEntryId)
+		return err == nil && stored.Status != nil
+	}, time.Second, 10*time.Millisecond)
+
+	assert.True(t, s.CancelRun("flaky", jr.LogEntryId))
+	jr = waitForRun(t, done)
+	assert.Equal(t, StatusCancelled, *jr.Status)
+	assert.Contains(t, jr.Log, "cancelled during retry delay due to cancellation")
+
+	stored, err := s.cfg.Store.JobRun("flaky", jr.LogEntryId)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCancelled, *stored.Status)
+}
+
+func TestCancelQueuedRun(t *testing.T) {
+	s := cancelSchedule(t, `
+max_parallel_jobs: 1
+jobs:
+  blocker:
+    command: [sleep, "10"]
+  waiting:
+    command: [echo, hi]
+`)
+	blocker, _ := s.job("blocker")
+	first := blocker.setup("ui", nil)
+	firstDone := s.launch(blocker, first)
+	assert.Eventually(t, func() bool { return s.pool.status().Running == 1 }, time.Second, 10*time.Millisecond)
+
+	waiting, _ := s.job("waiting")
+	jr := waiting.setup("ui", nil)
+	done := s.launch(waiting, jr)
+	assert.Eventually(t, func() bool {
+		stored, err := s.cfg.Store.JobRun("waiting", jr.LogEntryId)
+		return err == nil && stored.Queued
+	}, time.Second, 10*time.Millisecond)
+
+	assert.True(t, s.CancelRun("waiting", jr.LogEntryId))
+	jr = waitForRun(t, done)
+	assert.Equal(t, StatusCancelled, *jr.Status)
+	assert.Equal(t, "Run cancelled while queued", jr.Log)
+
+	// the job the run waited for keeps running
+	active, err := s.cfg.Store.IsJobRunActive("blocker", first.LogEntryId)
+	assert.NoError(t, err)
+	assert.True(t, active)
+	assert.True(t, s.CancelRun("blocker", first.LogEntryId))
+	assert.Equal(t, StatusCancelled, *waitForRun(t, firstDone).Status)
+}
+
+func TestClientCancelRun(t *testing.T) {
+	s := cancelSchedule(t, `
+auth:
+  tokens: [s3cret]
+jobs:
+  slow:
+    command: [sleep, "10"]
+`)
+	srv := httptest.NewServer(setupRouter(s))
+	defer srv.Close()
+
+	j, _ := s.job("slow")
+	jr := j.setup("ui", nil)
+	done := s.launch(j, jr)
+
+	err := NewClient(s.cfg, srv.URL, "wrong").CancelRun("slow", jr.LogEntryId)
+	assert.ErrorContains(t, err, "unauthorized")
+
+	client := NewClient(s.cfg, srv.URL+"/", "s3cret")
+	assert.NoError(t, client.CancelRun("slow", jr.LogEntryId))
+	assert.Equal(t, StatusCancelled, *waitForRun(t, done).Status)
+	assert.ErrorContains(t, client.CancelRun("slow", jr.LogEntryId), "run is not active")
+}
+
+func TestClientURL(t *testing.T) {
+	for _, scenario := range []struct {
+		cfg  Config
+		want string
+	}{
+		{cfg: Config{Port: "8081"}, want: "http://localhost:8081"},
+		{cfg: Config{Port: "8443", Bind: "0.0.0.0", TLSCert: "cert.pem"}, want: "https://localhost:8443"},
+		{cfg: Config{Port: "8081", Bind: "::1", BasePath: "/cheek/"}, want: "http://[::1]:8081/cheek"},
+		{cfg: Config{Port: "8081", Socket: "/run/cheek.sock"}, want: "http://cheek"},
+	} {
+		assert.Equal(t, scenario.want, NewClient(scenario.cfg, "", "").URL)
+	}
+	assert.Equal(t, "https://example.com/cheek", NewClient(Config{Port: "8081"}, "https://example.com/cheek/", "").URL)
+}
@@ -0,0 +1,91 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// clientTimeout is how long the CLI waits for a running cheek to respond.
+const clientTimeout = 30 * time.Second
+
+// Client talks to the API of a running cheek, for the commands of the
+// CLI that act on its runs.
+type Client struct {
+	// URL is where the API is served, including the base path
+	URL string
+	// Token is sent as bearer token if the API requires authentication
+	Token string
+	http  *http.Client
+}
+
+// NewClient creates a client for the cheek that runs with cfg, on the
+// same host. Set serverURL to reach a cheek elsewhere, e.g. behind a proxy.
+func NewClient(cfg Config, serverURL string, token string) *Client {
+	c := &Client{URL: strings.TrimSuffix(serverURL, "/"), Token: token, http: &http.Client{Timeout: clientTimeout}}
+	if c.URL != "" {
+		return c
+	}
+
+	scheme := "http"
+	if cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	host := cfg.Bind
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	addr := net.JoinHostPort(host, cfg.Port)
+	if cfg.Socket != "" {
+		// the host doesn't matter, every connection goes to the socket
+		addr = "cheek"
+		socket := cfg.Socket
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+	}
+	c.URL = fmt.Sprintf("%s://%s%s", scheme, addr, normalizeBasePath(cfg.BasePath))
+	return c
+}
+
+// post sends a POST request to the API, responses with another status
+// than want are turned into an error.
+func (c *Client) post(path string, want int) error {
+	req, err := http.NewRequest("POST", c.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach cheek at %s: %w", c.URL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == want {
+		return nil
+	}
+	var status Response
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil || status.Status == "" {
+		return fmt.Errorf("unexpected response from cheek: %s", resp.Status)
+	}
+	return fmt.Errorf("%s", strings.TrimPrefix(status.Status, "error: "))
+}
+
+// CancelRun cancels an active run of a job.
+func (c *Client) CancelRun(jobName string, id int) error {
+	if err := c.post(fmt.Sprintf("/api/jobs/%s/runs/%d/cancel", url.PathEscape(jobName), id), http.StatusAccepted); err != nil {
+		return fmt.Errorf("cannot cancel run %d of job %s: %w", id, jobName, err)
+	}
+	return nil
+}
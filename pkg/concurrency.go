@@ -0,0 +1,296 @@
+package cheek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Concurrency policies, these define what happens when a
+// job gets triggered while a previous run is still active.
+const (
+	ConcurrencyAllow   = "allow"
+	ConcurrencyForbid  = "forbid"
+	ConcurrencyQueue   = "queue"
+	ConcurrencyReplace = "replace"
+)
+
+// waitingForPreviousRun is what runs queued by the queue policy wait for.
+const waitingForPreviousRun = "the previous run"
+
+// defaultMaxQueued is the number of runs that can wait for
+// their turn under the queue policy if not set explicitly.
+const defaultMaxQueued = 1
+
+// errJobReplaced is the cancellation cause of runs that
+// get replaced by a newer run under the replace policy.
+var errJobReplaced = errors.New("replacement by a newer run")
+
+// jobState holds the runtime state of a job, it is shared between
+// the specs of a job across schedule reloads.
+type jobState struct {
+	// slot is held by the active run for policies that
+	// don't allow runs to overlap
+	slot chan struct{}
+
+	mu sync.Mutex
+	// waiting holds the runs queued for the slot, oldest first
+	waiting []*QueuedRun
+	current context.CancelCauseFunc
+}
+
+func newJobState() *jobState {
+	return &jobState{
+		slot: make(chan struct{}, 1),
+	}
+}
+
+// tryAcquire takes the slot if it is free.
+func (st *jobState) tryAcquire() bool {
+	select {
+	case st.slot <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire waits for the slot to become free.
+func (st *jobState) acquire(ctx context.Context) error {
+	select {
+	case st.slot <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (st *jobState) release() {
+	st.mu.Lock()
+	st.current = nil
+	st.mu.Unlock()
+	<-st.slot
+}
+
+// enqueue reserves a place in the queue, unless it is full. A maxQueued
+// of 0 doesn't limit the queue.
+func (st *jobState) enqueue(maxQueued int, qr *QueuedRun) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if maxQueued > 0 && len(st.waiting) >= maxQueued {
+		return false
+	}
+	st.waiting = append(st.waiting, qr)
+	return true
+}
+
+func (st *jobState) dequeue(qr *QueuedRun) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if i := slices.Index(st.waiting, qr); i >= 0 {
+		st.waiting = slices.Delete(st.waiting, i, i+1)
+	}
+}
+
+// queuedRuns returns the runs that wait for the slot.
+func (st *jobState) queuedRuns() []QueuedRun {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	runs := make([]QueuedRun, 0, len(st.waiting))
+	for _, qr := range st.waiting {
+		runs = append(runs, *qr)
+	}
+	return runs
+}
+
+// cancelCurrent cancels the run that holds the slot, if any.
+func (st *jobState) cancelCurrent(cause error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.current != nil {
+		st.current(cause)
+	}
+}
+
+func (st *jobState) setCurrent(cancel context.CancelCauseFunc) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.current = cancel
+}
+
+// runState returns the runtime state of the job.
+func (j *JobSpec) runState() *jobState {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.state == nil {
+		j.state = newJobState()
+	}
+	return j.state
+}
+
+// concurrencyPolicy returns the concurrency policy that applies to the job,
+// disable_concurrent_execution is a shorthand for the queue policy.
+func (j *JobSpec) concurrencyPolicy() string {
+	switch {
+	case j.ConcurrencyPolicy != "":
+		return j.ConcurrencyPolicy
+	case j.DisableConcurrentExecution:
+		return ConcurrencyQueue
+	default:
+		return ConcurrencyAllow
+	}
+}
+
+// maxQueued returns how many runs can wait for their turn under the queue
+// policy, 0 means any number. Runs of jobs that set disable_concurrent_execution
+// have always waited without limit, so they keep doing so unless max_queued
+// is set.
+func (j *JobSpec) maxQueued() int {
+	switch {
+	case j.MaxQueued > 0:
+		return j.MaxQueued
+	case j.DisableConcurrentExecution:
+		return 0
+	default:
+		return defaultMaxQueued
+	}
+}
+
+func (j *JobSpec) ValidateConcurrencyPolicy() error {
+	switch j.ConcurrencyPolicy {
+	case "", ConcurrencyAllow, ConcurrencyForbid, ConcurrencyQueue, ConcurrencyReplace:
+	default:
+		return fmt.Errorf("concurrency_policy '%s' for job '%s' not valid, should be one of %s, %s, %s or %s", j.ConcurrencyPolicy, j.Name, ConcurrencyAllow, ConcurrencyForbid, ConcurrencyQueue, ConcurrencyReplace)
+	}
+	if j.DisableConcurrentExecution && j.concurrencyPolicy() != ConcurrencyQueue {
+		return fmt.Errorf("job '%s' sets disable_concurrent_execution, which conflicts with concurrency_policy '%s'", j.Name, j.ConcurrencyPolicy)
+	}
+	if j.MaxQueued < 0 {
+		return fmt.Errorf("max_queued for job '%s' cannot be negative", j.Name)
+	}
+	return nil
+}
+
+// run triggers a run of the job, honouring its concurrency policy. All
+// triggers go through here: cron, other jobs, catch-ups, the UI and the API.
+func (j *JobSpec) run(ctx context.Context, trigger string) JobRun {
+	return j.runSetUp(ctx, j.setup(trigger, j.defaultParams()))
+}
+
+// runSetUp carries out a run that has been set up, for callers that need to
+// know the id of the run before it gets going.
+func (j *JobSpec) runSetUp(ctx context.Context, jr JobRun) (done JobRun) {
+	defer func() { j.metrics().finished(done) }()
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	defer j.track(jr, cancel)()
+
+	if policy := j.concurrencyPolicy(); policy != ConcurrencyAllow {
+		st := j.runState()
+		switch policy {
+		case ConcurrencyForbid:
+			if !st.tryAcquire() {
+				return j.skip(jr, "previous run is still active")
+			}
+		case ConcurrencyQueue:
+			if !st.tryAcquire() {
+				maxQueued := j.maxQueued()
+				qr := &QueuedRun{Id: jr.LogEntryId, Job: jr.Name, Priority: j.Priority, TriggeredAt: jr.TriggeredAt, TriggeredBy: jr.TriggeredBy, WaitingFor: waitingForPreviousRun}
+				if !st.enqueue(maxQueued, qr) {
+					return j.skip(jr, fmt.Sprintf("previous run is still active and %d run(s) already queued", maxQueued))
+				}
+				// the run stays queued until it gets the workers it needs below
+				jr.Queued = true
+				jr.save()
+				j.metrics().addQueued(j.Name, 1)
+				err := st.acquire(runCtx)
+				st.dequeue(qr)
+				if err != nil {
+					jr.Queued = false
+					j.metrics().addQueued(j.Name, -1)
+					return j.stopWaiting(runCtx, jr, "queued")
+				}
+			}
+		case ConcurrencyReplace:
+			st.cancelCurrent(errJobReplaced)
+			if err := st.acquire(runCtx); err != nil {
+				return j.stopWaiting(runCtx, jr, "waiting for the previous run to stop")
+			}
+		}
+		defer st.release()
+		st.setCurrent(cancel)
+	}
+
+	// wait for the slots of the job's concurrency groups and a free worker,
+	// always in the same order so runs can't block each other
+	for _, p := range j.semaphores() {
+		if !p.tryAcquire() {
+			if !jr.Queued {
+				jr.Queued = true
+				jr.save()
+				j.metrics().addQueued(j.Name, 1)
+			}
+			if err := p.acquire(runCtx, &jr, j.Priority); err != nil {
+				jr.Queued = false
+				j.metrics().addQueued(j.Name, -1)
+				return j.stopWaiting(runCtx, jr, "queued")
+			}
+		}
+		defer p.release()
+	}
+	if jr.Queued {
+		jr.Queued = false
+		jr.save()
+		j.metrics().addQueued(j.Name, -1)
+	}
+
+	j.metrics().addRunning(j.Name, 1)
+	defer j.metrics().addRunning(j.Name, -1)
+	return j.execWithRetries(runCtx, jr)
+}
+
+// semaphores returns the concurrency groups of the job, sorted by name,
+// followed by the worker pool of the schedule the job belongs to.
+func (j *JobSpec) semaphores() []*workerPool {
+	if j.globalSchedule == nil {
+		return nil
+	}
+	s := j.globalSchedule
+
+	names := slices.Clone(j.Groups)
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	var sems []*workerPool
+	for _, name := range names {
+		if g, ok := s.group(name); ok {
+			sems = append(sems, g)
+		}
+	}
+	if s.pool != nil {
+		sems = append(sems, s.pool)
+	}
+	return sems
+}
+
+// skip records a run that did not execute.
+func (j *JobSpec) skip(jr JobRun, reason string) JobRun {
+	j.log.Info().Str("job", j.Name).Str("trigger", jr.TriggeredBy).Str("concurrency_policy", j.concurrencyPolicy()).Msgf("Run skipped: %s", reason)
+	status := StatusSkipped
+	jr.Status = &status
+	jr.logBuf.WriteString(fmt.Sprintf("Run skipped: %s", reason))
+	jr.flushLogBuffer()
+	jr.save()
+	return jr
+}
+
+// cancelReason describes why a run's context got cancelled.
+func cancelReason(ctx context.Context) string {
+	if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, context.Canceled) && !errors.Is(cause, context.DeadlineExceeded) {
+		return cause.Error()
+	}
+	return "scheduler shutdown"
+}
@@ -0,0 +1,371 @@
+package cheek
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConcurrencyPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     *JobSpec
+		wantErr bool
+	}{
+		{"default", &JobSpec{Name: "test"}, false},
+		{"replace", &JobSpec{Name: "test", ConcurrencyPolicy: ConcurrencyReplace}, false},
+		{"invalid", &JobSpec{Name: "test", ConcurrencyPolicy: "sometimes"}, true},
+		{"disable concurrent execution", &JobSpec{Name: "test", DisableConcurrentExecution: true}, false},
+		{"disable concurrent execution with queue", &JobSpec{Name: "test", DisableConcurrentExecution: true, ConcurrencyPolicy: ConcurrencyQueue}, false},
+		{"disable concurrent execution with allow", &JobSpec{Name: "test", DisableConcurrentExecution: true, ConcurrencyPolicy: ConcurrencyAllow}, true},
+		{"negative max queued", &JobSpec{Name: "test", ConcurrencyPolicy: ConcurrencyQueue, MaxQueued: -1}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.job.ValidateConcurrencyPolicy()
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// runConcurrently triggers n runs of the job, each one shortly after the other.
+func runConcurrently(j *JobSpec, n int) []JobRun {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var runs []JobRun
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jr := j.run(context.Background(), "test")
+			mu.Lock()
+			runs = append(runs, jr)
+			mu.Unlock()
+		}()
+		time.Sleep(100 * time.Millisecond)
+	}
+	wg.Wait()
+	return runs
+}
+
+func countStatus(runs []JobRun, status int) int {
+	n := 0
+	for _, jr := range runs {
+		if *jr.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func TestConcurrencyPolicies(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	tests := []struct {
+		policy    string
+		maxQueued int
+		ok        int
+		skipped   int
+		cancelled int
+	}{
+		{ConcurrencyAllow, 0, 3, 0, 0},
+		{ConcurrencyForbid, 0, 1, 2, 0},
+		{ConcurrencyQueue, 0, 2, 1, 0},
+		{ConcurrencyQueue, 2, 3, 0, 0},
+		// the first two runs get replaced by the one after them
+		{ConcurrencyReplace, 0, 1, 0, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.policy, func(t *testing.T) {
+			cfg := cfg
+			cfg.Store = NewMemoryStore()
+			j := &JobSpec{
+				Name:              "test",
+				Command:           []string{"sleep", "0.5"},
+				ConcurrencyPolicy: tc.policy,
+				MaxQueued:         tc.maxQueued,
+				cfg:               cfg,
+			}
+
+			runs := runConcurrently(j, 3)
+
+			assert.Equal(t, tc.ok, countStatus(runs, StatusOK))
+			assert.Equal(t, tc.skipped, countStatus(runs, StatusSkipped))
+			assert.Equal(t, tc.cancelled, countStatus(runs, StatusCancelled))
+			stored, err := cfg.Store.JobRuns("test", 10, false)
+			assert.NoError(t, err)
+			assert.Len(t, stored, 3)
+		})
+	}
+}
+
+func TestConcurrencyLegacyQueueUnbounded(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	cfg.Store = NewMemoryStore()
+
+	j := &JobSpec{
+		Name:                       "test",
+		Command:                    []string{"sleep", "0.2"},
+		DisableConcurrentExecution: true,
+		cfg:                        cfg,
+	}
+	assert.Equal(t, 0, j.maxQueued())
+	assert.Equal(t, 4, countStatus(runConcurrently(j, 4), StatusOK))
+
+	j.MaxQueued = 2
+	assert.Equal(t, 2, j.maxQueued())
+	j.DisableConcurrentExecution = false
+	j.MaxQueued = 0
+	j.ConcurrencyPolicy = ConcurrencyQueue
+	assert.Equal(t, defaultMaxQueued, j.maxQueued())
+}
+
+func TestConcurrencyReplaceLog(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:              "test",
+		Command:           []string{"sleep", "0.5"},
+		ConcurrencyPolicy: ConcurrencyReplace,
+		cfg:               cfg,
+	}
+
+	runs := runConcurrently(j, 2)
+	for _, jr := range runs {
+		if *jr.Status == StatusCancelled {
+			assert.Contains(t, jr.Log, "Job killed due to replacement by a newer run")
+		}
+	}
+}
+
+func TestConcurrencyReplaceNoEvents(t *testing.T) {
+	s := cancelSchedule(t, `
+jobs:
+  sync:
+    command: [sh, -c, "echo started && sleep 10"]
+    concurrency_policy: replace
+    on_error:
+      trigger_job: [alert]
+  alert:
+    command: [echo, alert]
+`)
+	j, _ := s.job("sync")
+	first := j.setup("ui", nil)
+	firstDone := s.launch(j, first)
+	assert.Eventually(t, func() bool {
+		lines, err := s.cfg.Store.LogLines(first.LogEntryId, 0)
+		return err == nil && len(lines) > 0
+	}, 3*logLinesFlushInterval, 10*time.Millisecond)
+
+	second := j.setup("ui", nil)
+	secondDone := s.launch(j, second)
+	replaced := waitForRun(t, firstDone)
+	assert.Equal(t, StatusCancelled, *replaced.Status)
+	assert.Contains(t, replaced.Log, "Job killed due to replacement by a newer run")
+
+	assert.True(t, s.CancelRun("sync", second.LogEntryId))
+	waitForRun(t, secondDone)
+
+	// neither the replaced nor the cancelled run triggers on_error
+	time.Sleep(200 * time.Millisecond)
+	alerts, err := s.cfg.Store.JobRuns("alert", 10, false)
+	assert.NoError(t, err)
+	assert.Empty(t, alerts)
+}
+
+func TestConcurrencyQueueMarksQueued(t *testing.T) {
+	s := cancelSchedule(t, `
+jobs:
+  sync:
+    command: [sleep, "0.5"]
+    concurrency_policy: queue
+`)
+	j, _ := s.job("sync")
+	firstDone := s.launch(j, j.setup("ui", nil))
+	assert.Eventually(t, func() bool { return len(j.runState().slot) == 1 }, time.Second, 10*time.Millisecond)
+
+	jr := j.setup("ui", nil)
+	done := s.launch(j, jr)
+	assert.Eventually(t, func() bool {
+		page, err := s.cfg.Store.Runs(RunQuery{Status: []string{RunQueued}})
+		return err == nil && len(page.Runs) == 1 && page.Runs[0].LogEntryId == jr.LogEntryId
+	}, time.Second, 10*time.Millisecond)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/schedule/queue", nil)
+	setupRouter(s).ServeHTTP(resp, req)
+	var sqr ScheduleQueueResponse
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &sqr))
+	if assert.Len(t, sqr.Jobs["sync"].Runs, 1) {
+		assert.Equal(t, jr.LogEntryId, sqr.Jobs["sync"].Runs[0].Id)
+		assert.Equal(t, waitingForPreviousRun, sqr.Jobs["sync"].Runs[0].WaitingFor)
+	}
+
+	waitForRun(t, firstDone)
+	jr = waitForRun(t, done)
+	assert.Equal(t, StatusOK, *jr.Status)
+	stored, err := s.cfg.Store.JobRun("sync", jr.LogEntryId)
+	assert.NoError(t, err)
+	assert.False(t, stored.Queued)
+	assert.Empty(t, j.runState().queuedRuns())
+}
+
+func TestConcurrencyQueueShutdown(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:              "test",
+		Command:           []string{"sleep", "10"},
+		ConcurrencyPolicy: ConcurrencyQueue,
+		cfg:               cfg,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go j.run(ctx, "test")
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan JobRun)
+	go func() { done <- j.run(ctx, "test") }()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case jr := <-done:
+		assert.Equal(t, StatusSkipped, *jr.Status)
+		assert.Contains(t, jr.Log, "scheduler shutdown while queued")
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued run did not stop on shutdown")
+	}
+}
+
+func TestConcurrencyGroups(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, `
+concurrency_groups:
+  db_writer:
+    capacity: 1
+jobs:
+  load:
+    command: sleep 0.3
+    groups: [db_writer]
+  migrate:
+    command: sleep 0.3
+    groups: [db_writer, db_writer]
+  report:
+    command: sleep 0.3
+`)
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s, err := loadSchedule(NewLogger("debug", nil, new(tsBuffer)), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	durations := make(map[string]time.Duration)
+	var mu sync.Mutex
+	for _, name := range []string{"load", "migrate", "report"} {
+		wg.Add(1)
+		go func(j *JobSpec) {
+			defer wg.Done()
+			jr := j.run(context.Background(), "test")
+			assert.Equal(t, StatusOK, *jr.Status)
+			mu.Lock()
+			durations[j.Name] = time.Since(start)
+			mu.Unlock()
+		}(s.Jobs[name])
+	}
+
+	// check that the waiting run is visible
+	assert.Eventually(t, func() bool {
+		qs := s.groups["db_writer"].status()
+		return qs.Depth == 1 && qs.Runs[0].WaitingFor == "db_writer"
+	}, time.Second, 10*time.Millisecond)
+
+	wg.Wait()
+	// the group serializes load and migrate, report doesn't wait
+	assert.Less(t, durations["report"], 600*time.Millisecond)
+	assert.GreaterOrEqual(t, max(durations["load"], durations["migrate"]), 600*time.Millisecond)
+}
+
+func TestConcurrencyGroupsValidation(t *testing.T) {
+	for name, spec := range map[string]string{
+		"unknown group": `
+jobs:
+  load:
+    command: echo load
+    groups: [db_writer]
+`,
+		"no capacity": `
+concurrency_groups:
+  db_writer: {}
+jobs:
+  load:
+    command: echo load
+    groups: [db_writer]
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			fn := filepath.Join(t.TempDir(), "schedule.yaml")
+			writeSchedule(t, fn, spec)
+			_, err := loadSchedule(NewLogger("debug", nil, new(tsBuffer)), Config{}, fn)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestConcurrencyGroupsReload(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, `
+concurrency_groups:
+  db_writer:
+    capacity: 1
+jobs:
+  load:
+    command: echo load
+    groups: [db_writer]
+`)
+
+	s, err := loadSchedule(NewLogger("debug", nil, new(tsBuffer)), Config{}, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := s.groups["db_writer"]
+
+	writeSchedule(t, fn, `
+concurrency_groups:
+  db_writer:
+    capacity: 2
+  db_reader:
+    capacity: 5
+jobs:
+  load:
+    command: echo load
+    groups: [db_writer, db_reader]
+`)
+	assert.NoError(t, s.reload())
+
+	// the semaphore of an existing group is kept, so runs holding it are accounted for
+	assert.Same(t, g, s.groups["db_writer"])
+	assert.Equal(t, 2, g.status().MaxParallelJobs)
+	assert.Equal(t, 5, s.groups["db_reader"].status().MaxParallelJobs)
+}
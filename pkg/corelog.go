@@ -0,0 +1,250 @@
+package cheek
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultCoreLogsLimit is the number of core logs returned if no limit is given.
+	defaultCoreLogsLimit = 120
+	// maxCoreLogsLimit is the maximum number of core logs returned at once.
+	maxCoreLogsLimit = 1000
+)
+
+// CoreLogEntry is a log message of cheek itself.
+type CoreLogEntry struct {
+	ID      int        `json:"id" db:"id"`
+	Time    time.Time  `json:"time" db:"time"`
+	Level   string     `json:"level" db:"level"`
+	Job     string     `json:"job,omitempty" db:"job"`
+	Message string     `json:"message" db:"message"`
+	Fields  JSONFields `json:"fields,omitempty" db:"fields"`
+}
+
+// JSONFields are the extra fields of a core log, stored as json.
+type JSONFields map[string]any
+
+func (f JSONFields) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (f *JSONFields) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("can't scan %T into fields", src)
+	}
+	return json.Unmarshal(b, f)
+}
+
+// parseCoreLog turns a log message as written by zerolog into an entry,
+// messages that aren't json are kept as they are.
+func parseCoreLog(p []byte) CoreLogEntry {
+	e := CoreLogEntry{Time: time.Now().UTC()}
+
+	var fields map[string]any
+	if err := json.Unmarshal(p, &fields); err != nil {
+		e.Message = strings.TrimSpace(string(p))
+		return e
+	}
+
+	if v, ok := fields[zerolog.TimestampFieldName].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			e.Time = t.UTC()
+		}
+	}
+	e.Level, _ = fields[zerolog.LevelFieldName].(string)
+	e.Message, _ = fields[zerolog.MessageFieldName].(string)
+	e.Job, _ = fields["job"].(string)
+	for _, k := range []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, zerolog.MessageFieldName, "job"} {
+		delete(fields, k)
+	}
+	if len(fields) > 0 {
+		e.Fields = fields
+	}
+	return e
+}
+
+// CoreLogQuery filters core logs, zero values don't filter.
+type CoreLogQuery struct {
+	// Level is the minimum level of the logs
+	Level string
+	Job   string
+	Since time.Time
+	Until time.Time
+	// Search matches text in the message and the extra fields
+	Search string
+	// Before only returns logs with a lower id, which allows to page through them
+	Before int
+	Limit  int
+}
+
+// levels returns the level of the query and all levels above it.
+func (q CoreLogQuery) levels() ([]string, error) {
+	if q.Level == "" {
+		return nil, nil
+	}
+	lowest, err := zerolog.ParseLevel(q.Level)
+	if err != nil {
+		return nil, err
+	}
+	var levels []string
+	for l := lowest; l <= zerolog.PanicLevel; l++ {
+		levels = append(levels, l.String())
+	}
+	return levels, nil
+}
+
+func (q CoreLogQuery) limit() int {
+	if q.Limit <= 0 {
+		return defaultCoreLogsLimit
+	}
+	return min(q.Limit, maxCoreLogsLimit)
+}
+
+// validate checks the query before it gets run.
+func (q CoreLogQuery) validate() error {
+	if _, err := q.levels(); err != nil {
+		return fmt.Errorf("level: %w", err)
+	}
+	return nil
+}
+
+// matches tells whether an entry passes the filters of the query.
+func (q CoreLogQuery) matches(e CoreLogEntry, levels []string) bool {
+	if levels != nil && !slices.Contains(levels, e.Level) {
+		return false
+	}
+	if q.Job != "" && e.Job != q.Job {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	if q.Before > 0 && e.ID >= q.Before {
+		return false
+	}
+	if q.Search != "" {
+		fields, _ := e.Fields.Value()
+		text, _ := fields.(string)
+		search := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(e.Message), search) && !strings.Contains(strings.ToLower(text), search) {
+			return false
+		}
+	}
+	return true
+}
+
+// insertCoreLogs inserts log messages of cheek itself
+func insertCoreLogs(tx *sqlx.Tx, entries []CoreLogEntry) error {
+	for _, e := range entries {
+		_, err := tx.NamedExec(`
+			INSERT INTO core_log (time, level, job, message, fields)
+			VALUES (:time, :level, NULLIF(:job, ''), :message, :fields)`, e)
+		if err != nil {
+			return fmt.Errorf("insert core log: %w", err)
+		}
+	}
+	return nil
+}
+
+// LoadCoreLogs loads the core logs matching the query, newest first.
+func LoadCoreLogs(db *sqlx.DB, q CoreLogQuery) ([]CoreLogEntry, error) {
+	levels, err := q.levels()
+	if err != nil {
+		return nil, fmt.Errorf("level: %w", err)
+	}
+
+	var where []string
+	var args []any
+	if levels != nil {
+		where = append(where, "level IN (?"+strings.Repeat(", ?", len(levels)-1)+")")
+		for _, l := range levels {
+			args = append(args, l)
+		}
+	}
+	if q.Job != "" {
+		where = append(where, "job = ?")
+		args = append(args, q.Job)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "julianday(time) >= julianday(?)")
+		args = append(args, q.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "julianday(time) <= julianday(?)")
+		args = append(args, q.Until.UTC().Format(time.RFC3339Nano))
+	}
+	if q.Search != "" {
+		where = append(where, `(message LIKE ? ESCAPE '\' OR fields LIKE ? ESCAPE '\')`)
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q.Search) + "%"
+		args = append(args, pattern, pattern)
+	}
+	if q.Before > 0 {
+		where = append(where, "id < ?")
+		args = append(args, q.Before)
+	}
+
+	query := "SELECT id, time, level, COALESCE(job, '') AS job, message, fields FROM core_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, q.limit())
+
+	logs := []CoreLogEntry{}
+	if err := db.Select(&logs, query, args...); err != nil {
+		return nil, fmt.Errorf("load core logs: %w", err)
+	}
+	return logs, nil
+}
+
+// pruneCoreLog deletes the core logs beyond keep entries or from before the cutoff.
+func pruneCoreLog(tx *sqlx.Tx, keep int, before time.Time) (int64, error) {
+	if keep == 0 && before.IsZero() {
+		return 0, nil
+	}
+	// a negative limit means no limit for sqlite
+	if keep == 0 {
+		keep = -1
+	}
+	var olderThan any
+	if !before.IsZero() {
+		olderThan = before.UTC().Format(time.RFC3339Nano)
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM core_log
+		WHERE julianday(time) < julianday(?)
+			OR id NOT IN (SELECT id FROM core_log ORDER BY id DESC LIMIT ?)`,
+		olderThan, keep)
+	if err != nil {
+		return 0, fmt.Errorf("prune core log: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,136 @@
+package cheek
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCoreLog(t *testing.T) {
+	e := parseCoreLog([]byte(`{"level":"warn","job":"backup","attempt":2,"time":"2024-05-01T10:00:00+02:00","message":"Retrying"}` + "\n"))
+	assert.Equal(t, "warn", e.Level)
+	assert.Equal(t, "backup", e.Job)
+	assert.Equal(t, "Retrying", e.Message)
+	assert.Equal(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), e.Time)
+	assert.Equal(t, JSONFields{"attempt": float64(2)}, e.Fields)
+
+	e = parseCoreLog([]byte("not json\n"))
+	assert.Equal(t, "not json", e.Message)
+	assert.Empty(t, e.Level)
+	assert.False(t, e.Time.IsZero())
+}
+
+func TestStoreCoreLogQuery(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			entries := []CoreLogEntry{
+				{Time: now.Add(-3 * time.Hour), Level: "debug", Message: "tick"},
+				{Time: now.Add(-2 * time.Hour), Level: "info", Job: "backup", Message: "Job triggered"},
+				{Time: now.Add(-time.Hour), Level: "warn", Job: "backup", Message: "Couldn't save 50% of the output", Fields: JSONFields{"error": "disk full"}},
+				{Time: now, Level: "error", Job: "report", Message: "Job failed"},
+			}
+			for _, e := range entries {
+				assert.NoError(t, store.WriteCoreLog(e))
+			}
+			if s, ok := store.(*SQLiteStore); ok {
+				assert.NoError(t, s.Flush())
+			}
+
+			messages := func(q CoreLogQuery) []string {
+				logs, err := store.CoreLogs(q)
+				assert.NoError(t, err)
+				var ms []string
+				for _, l := range logs {
+					ms = append(ms, l.Message)
+				}
+				return ms
+			}
+
+			assert.Equal(t, []string{"Job failed", "Couldn't save 50% of the output", "Job triggered", "tick"}, messages(CoreLogQuery{}))
+			assert.Equal(t, []string{"Job failed", "Couldn't save 50% of the output"}, messages(CoreLogQuery{Level: "warn"}))
+			assert.Equal(t, []string{"Couldn't save 50% of the output", "Job triggered"}, messages(CoreLogQuery{Job: "backup"}))
+			assert.Equal(t, []string{"Couldn't save 50% of the output", "Job triggered"}, messages(CoreLogQuery{Since: now.Add(-150 * time.Minute), Until: now.Add(-30 * time.Minute)}))
+			assert.Equal(t, []string{"Couldn't save 50% of the output"}, messages(CoreLogQuery{Search: "50%"}))
+			assert.Equal(t, []string{"Couldn't save 50% of the output"}, messages(CoreLogQuery{Search: "DISK"}))
+			assert.Empty(t, messages(CoreLogQuery{Search: "5_%"}))
+
+			// page through the logs
+			page, err := store.CoreLogs(CoreLogQuery{Limit: 3})
+			assert.NoError(t, err)
+			assert.Len(t, page, 3)
+			assert.Equal(t, []string{"tick"}, messages(CoreLogQuery{Limit: 3, Before: page[2].ID}))
+
+			logs, err := store.CoreLogs(CoreLogQuery{Job: "backup", Level: "warn"})
+			assert.NoError(t, err)
+			assert.Len(t, logs, 1)
+			assert.Equal(t, JSONFields{"error": "disk full"}, logs[0].Fields)
+			assert.True(t, entries[2].Time.Equal(logs[0].Time))
+
+			_, err = store.CoreLogs(CoreLogQuery{Level: "loud"})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMigrateCoreLogs(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	assert.NoError(t, MigrateDB(db, 4))
+	_, err := db.Exec(`INSERT INTO log (job, message) VALUES
+		('_cheek', '{"level":"info","job":"backup","time":"2024-05-01T10:00:00Z","message":"Job triggered","trigger":"cron"}'),
+		('_cheek', 'not json'),
+		('backup', 'output')`)
+	assert.NoError(t, err)
+	assert.NoError(t, MigrateDB(db, 5))
+
+	logs, err := LoadCoreLogs(db, CoreLogQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "not json", logs[0].Message)
+	assert.Equal(t, "Job triggered", logs[1].Message)
+	assert.Equal(t, "info", logs[1].Level)
+	assert.Equal(t, "backup", logs[1].Job)
+	assert.Equal(t, JSONFields{"trigger": "cron"}, logs[1].Fields)
+	assert.True(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).Equal(logs[1].Time))
+
+	assert.Equal(t, 1, countRows(t, db, "SELECT COUNT(*) FROM log"))
+}
+
+func TestCoreLogsAPI(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	s := &Schedule{Jobs: map[string]*JobSpec{}, cfg: cfg, log: zerolog.Nop()}
+
+	log := NewLogger("debug", cfg.Store)
+	log.Debug().Msg("tick")
+	log.Warn().Str("job", "backup").Msg("Job failed")
+
+	get := func(url string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		setupRouter(s).ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := get("/api/core/logs?level=warn&job=backup&since=2020-01-01")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var logs []CoreLogEntry
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &logs))
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "Job failed", logs[0].Message)
+
+	resp = get("/api/core/logs?q=nothing")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, "[]", resp.Body.String())
+
+	for _, url := range []string{"/api/core/logs?level=loud", "/api/core/logs?since=yesterday", "/api/core/logs?limit=ten"} {
+		assert.Equal(t, http.StatusBadRequest, get(url).Code, url)
+	}
+}
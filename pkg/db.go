@@ -1,7 +1,10 @@
 package cheek
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -20,9 +23,9 @@ type LogLine struct {
 }
 
 func OpenDB(dbPath string) (*sqlx.DB, error) {
-	db, err := sqlx.Open("sqlite", dbPath)
+	db, err := ConnectDB(dbPath)
 	if err != nil {
-		return nil, fmt.Errorf("open db: %w", err)
+		return nil, err
 	}
 
 	if err := InitDB(db); err != nil {
@@ -32,65 +35,69 @@ func OpenDB(dbPath string) (*sqlx.DB, error) {
 	return db, nil
 }
 
-func InitDB(db *sqlx.DB) error {
-	// Create the log table if it doesn't exist
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS log (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        job TEXT,
-        triggered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		triggered_by TEXT,
-        duration INTEGER,
-        status INTEGER,
-        message TEXT,
-		is_running INTEGER DEFAULT 0,
-		UNIQUE(job, triggered_at, triggered_by)
-    )`)
-	if err != nil {
-		return fmt.Errorf("create log table: %w", err)
+// busyTimeout is how long a connection waits for a lock
+// held by another connection before giving up.
+const busyTimeout = 5 * time.Second
+
+// dsn adds the pragmas every connection gets to the path of a db. WAL mode
+// lets readers carry on while a write is in progress.
+func dsn(dbPath string, pragmas ...string) string {
+	pragmas = append([]string{
+		fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()),
+		"journal_mode(WAL)",
+		"synchronous(NORMAL)",
+	}, pragmas...)
+
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
 	}
+	return dbPath + sep + "_pragma=" + strings.Join(pragmas, "&_pragma=")
+}
 
-	// Add is_running column to existing log table if it doesn't exist
-	_, err = db.Exec(`ALTER TABLE log ADD COLUMN is_running INTEGER DEFAULT 0`)
+// ConnectDB opens the db without migrating it.
+func ConnectDB(dbPath string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite", dsn(dbPath))
 	if err != nil {
-		// Ignore error if column already exists
-		// SQLite doesn't have a clean way to check if column exists
-	}
-
-	// Create the log_lines table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS log_lines (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		job_run_id INTEGER NOT NULL,
-		line_number INTEGER NOT NULL,
-		timestamp TEXT NOT NULL,
-		content TEXT NOT NULL,
-		stream TEXT NOT NULL,
-		FOREIGN KEY (job_run_id) REFERENCES log(id),
-		UNIQUE(job_run_id, line_number)
-	)`)
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	return db, nil
+}
+
+// connectReadDB opens the db for reading only.
+func connectReadDB(dbPath string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite", dsn(dbPath, "query_only(1)"))
 	if err != nil {
-		return fmt.Errorf("create log_lines table: %w", err)
+		return nil, fmt.Errorf("open db: %w", err)
 	}
+	return db, nil
+}
 
-	// Create index for efficient queries
-	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_log_lines_job_run_id ON log_lines(job_run_id)`)
+// inTx runs fn in a transaction, which is committed if fn succeeds.
+func inTx(db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.Beginx()
 	if err != nil {
-		return fmt.Errorf("create log_lines index: %w", err)
-	}
-
-	// Perform cleanup to remove old, non-conforming records
-	_, err = db.Exec(`
-		DELETE FROM log
-		WHERE id NOT IN (
-			SELECT MIN(id)
-			FROM log
-			GROUP BY job, triggered_at, triggered_by
-		);
-	`)
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// InitDB brings the db schema up to date, it refuses dbs
+// that were migrated by a newer version of cheek.
+func InitDB(db *sqlx.DB) error {
+	// Allow freeing up space after pruning, this only has an
+	// effect on new databases, existing ones require a VACUUM
+	_, err := db.Exec(`PRAGMA auto_vacuum = INCREMENTAL`)
 	if err != nil {
-		return fmt.Errorf("cleanup old log records: %w", err)
+		return fmt.Errorf("set auto vacuum: %w", err)
 	}
 
-	return nil
+	return MigrateDB(db, 0)
 }
 
 // InsertLogLine inserts a single log line
@@ -105,6 +112,28 @@ func InsertLogLine(db *sqlx.DB, jobRunID int, lineNumber int, content string, st
 	return nil
 }
 
+// InsertLogLines inserts a batch of log lines in a single transaction
+func InsertLogLines(db *sqlx.DB, lines []LogLine) error {
+	if err := inTx(db, func(tx *sqlx.Tx) error { return insertLogLines(tx, lines) }); err != nil {
+		return fmt.Errorf("insert log lines: %w", err)
+	}
+	return nil
+}
+
+func insertLogLines(tx *sqlx.Tx, lines []LogLine) error {
+	// insert in chunks to stay clear of sqlite's limit on query variables
+	for start := 0; start < len(lines); start += logLinesBatchSize {
+		chunk := lines[start:min(start+logLinesBatchSize, len(lines))]
+		_, err := tx.NamedExec(`
+			INSERT INTO log_lines (job_run_id, line_number, timestamp, content, stream) 
+			VALUES (:job_run_id, :line_number, :timestamp, :content, :stream)`, chunk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetLogLines retrieves log lines for a job run, optionally after a specific line number
 func GetLogLines(db *sqlx.DB, jobRunID int, afterLineNumber int) ([]LogLine, error) {
 	var lines []LogLine
@@ -121,24 +150,37 @@ func GetLogLines(db *sqlx.DB, jobRunID int, afterLineNumber int) ([]LogLine, err
 	return lines, nil
 }
 
+// IsJobRunActive tells whether a job run is queued or running
+func IsJobRunActive(db *sqlx.DB, jobName string, id int) (bool, error) {
+	var active bool
+	err := db.Get(&active, "SELECT COALESCE(is_running, 0) OR COALESCE(is_queued, 0) FROM log WHERE job = ? AND id = ?", jobName, id)
+	if err != nil {
+		return false, fmt.Errorf("get job run state: %w", err)
+	}
+	return active, nil
+}
+
 // InsertOrUpdateJobRun inserts a new job run or updates an existing one
-func InsertOrUpdateJobRun(db *sqlx.DB, jr *JobRun) error {
-	// Determine is_running status
-	isRunning := 0
-	if jr.Status == nil {
+func InsertOrUpdateJobRun(db sqlx.Ext, jr *JobRun) error {
+	// Determine is_running and is_queued status
+	isRunning, isQueued := 0, 0
+	if jr.Queued {
+		isQueued = 1 // Job is waiting for a free worker
+	} else if jr.Status == nil {
 		isRunning = 1 // Job is still running if status is nil
 	}
 
 	// Perform an UPSERT (insert or update)
 	result, err := db.Exec(`
-		INSERT INTO log (job, triggered_at, triggered_by, duration, status, message, is_running) 
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO log (job, triggered_at, triggered_by, duration, status, message, is_running, is_queued, params) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(job, triggered_at, triggered_by) DO UPDATE SET 
 			duration = excluded.duration, 
 			status = excluded.status, 
 			message = excluded.message,
-			is_running = excluded.is_running`,
-		jr.Name, jr.TriggeredAt, jr.TriggeredBy, jr.Duration, jr.Status, jr.Log, isRunning)
+			is_running = excluded.is_running,
+			is_queued = excluded.is_queued`,
+		jr.Name, jr.TriggeredAt, jr.TriggeredBy, jr.Duration, jr.Status, jr.Log, isRunning, isQueued, jr.Params)
 	if err != nil {
 		return fmt.Errorf("insert or update job run: %w", err)
 	}
@@ -152,7 +194,7 @@ func InsertOrUpdateJobRun(db *sqlx.DB, jr *JobRun) error {
 
 		// If LastInsertId doesn't work, query for the ID
 		if jr.LogEntryId == 0 {
-			err = db.Get(&jr.LogEntryId,
+			err = sqlx.Get(db, &jr.LogEntryId,
 				"SELECT id FROM log WHERE job = ? AND triggered_at = ? AND triggered_by = ?",
 				jr.Name, jr.TriggeredAt, jr.TriggeredBy)
 			if err != nil {
@@ -170,14 +212,14 @@ func LoadJobRun(db *sqlx.DB, jobName string, id int) (JobRun, error) {
 
 	// if id -1 then load last run
 	if id == -1 {
-		err := db.Get(&jr, "SELECT id, triggered_at, triggered_by, duration, status, message FROM log WHERE job = ? ORDER BY triggered_at DESC LIMIT 1", jobName)
+		err := db.Get(&jr, "SELECT id, triggered_at, triggered_by, duration, status, is_queued, message, params FROM log WHERE job = ? ORDER BY triggered_at DESC LIMIT 1", jobName)
 		if err != nil {
 			return jr, fmt.Errorf("load latest job run: %w", err)
 		}
 		return jr, nil
 	}
 
-	err := db.Get(&jr, "SELECT id, triggered_at, triggered_by, duration, status, message FROM log WHERE id = ?", id)
+	err := db.Get(&jr, "SELECT id, triggered_at, triggered_by, duration, status, is_queued, message, params FROM log WHERE id = ?", id)
 	if err != nil {
 		return jr, fmt.Errorf("load job run by id: %w", err)
 	}
@@ -188,9 +230,9 @@ func LoadJobRun(db *sqlx.DB, jobName string, id int) (JobRun, error) {
 func LoadJobRuns(db *sqlx.DB, jobName string, nruns int, includeLogs bool) ([]JobRun, error) {
 	var query string
 	if includeLogs {
-		query = "SELECT id, triggered_at, triggered_by, duration, status, message FROM log WHERE job = ? ORDER BY triggered_at DESC LIMIT ?"
+		query = "SELECT id, triggered_at, triggered_by, duration, status, is_queued, message FROM log WHERE job = ? ORDER BY triggered_at DESC LIMIT ?"
 	} else {
-		query = "SELECT id, triggered_at, triggered_by, duration, status FROM log WHERE job = ? ORDER BY triggered_at DESC LIMIT ?"
+		query = "SELECT id, triggered_at, triggered_by, duration, status, is_queued FROM log WHERE job = ? ORDER BY triggered_at DESC LIMIT ?"
 	}
 
 	var jrs []JobRun
@@ -200,3 +242,17 @@ func LoadJobRuns(db *sqlx.DB, jobName string, nruns int, includeLogs bool) ([]Jo
 	}
 	return jrs, nil
 }
+
+// LoadLastScheduledRun returns when a job was last triggered by the scheduler,
+// or the zero time if it never was
+func LoadLastScheduledRun(db *sqlx.DB, jobName string) (time.Time, error) {
+	var triggeredAt time.Time
+	err := db.Get(&triggeredAt, "SELECT triggered_at FROM log WHERE job = ? AND triggered_by IN ('cron', ?) ORDER BY triggered_at DESC LIMIT 1", jobName, triggerCatchup)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("load last scheduled run: %w", err)
+	}
+	return triggeredAt, nil
+}
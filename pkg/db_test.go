@@ -1,18 +1,18 @@
 package cheek
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3" // Import SQLite driver for database/sql
 	"github.com/stretchr/testify/assert"
 )
 
 // setupTestDB creates an in-memory SQLite database for testing
 func setupTestDB(t *testing.T) *sqlx.DB {
 	t.Helper()
-	db, err := sqlx.Open("sqlite3", ":memory:")
+	db, err := sqlx.Open("sqlite", ":memory:")
 	if err != nil {
 		t.Fatalf("Failed to open in-memory database: %v", err)
 	}
@@ -30,7 +30,7 @@ func setupTestDB(t *testing.T) *sqlx.DB {
 // TestInitDB tests the InitDB function, including the cleanup logic.
 func TestInitDB(t *testing.T) {
 	// Create an in-memory SQLite database
-	db, err := sqlx.Open("sqlite3", ":memory:")
+	db, err := sqlx.Open("sqlite", ":memory:")
 	if err != nil {
 		t.Fatalf("Failed to open in-memory database: %v", err)
 	}
@@ -645,3 +645,76 @@ func TestLoadJobRunsMultipleJobs(t *testing.T) {
 	assert.Len(t, jrs, 1, "Should return 1 run for job_c")
 	assert.Equal(t, "manual", jrs[0].TriggeredBy, "job_c run should be manual trigger")
 }
+
+// TestLoadLastScheduledRun tests that only scheduler triggered runs are considered
+func TestLoadLastScheduledRun(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	lastRun, err := LoadLastScheduledRun(db, "test_job")
+	assert.NoError(t, err)
+	assert.True(t, lastRun.IsZero(), "Should return zero time for a job that never ran")
+
+	now := time.Now().Truncate(time.Second)
+	for _, jr := range []*JobRun{
+		{Name: "test_job", TriggeredAt: now.Add(-3 * time.Hour), TriggeredBy: "cron"},
+		{Name: "test_job", TriggeredAt: now.Add(-2 * time.Hour), TriggeredBy: triggerCatchup},
+		{Name: "test_job", TriggeredAt: now.Add(-1 * time.Hour), TriggeredBy: "ui"},
+		{Name: "other_job", TriggeredAt: now, TriggeredBy: "cron"},
+	} {
+		assert.NoError(t, InsertOrUpdateJobRun(db, jr))
+	}
+
+	lastRun, err = LoadLastScheduledRun(db, "test_job")
+	assert.NoError(t, err)
+	assert.True(t, now.Add(-2*time.Hour).Equal(lastRun), "Should ignore manually triggered runs")
+}
+
+func TestQueuedJobRun(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	jr := &JobRun{Name: "test_job", TriggeredAt: time.Now(), TriggeredBy: "cron", Queued: true}
+	assert.NoError(t, InsertOrUpdateJobRun(db, jr))
+
+	var isRunning, isQueued int
+	assert.NoError(t, db.QueryRow("SELECT is_running, is_queued FROM log WHERE id = ?", jr.LogEntryId).Scan(&isRunning, &isQueued))
+	assert.Equal(t, 0, isRunning)
+	assert.Equal(t, 1, isQueued)
+
+	loaded, err := LoadJobRun(db, "test_job", jr.LogEntryId)
+	assert.NoError(t, err)
+	assert.True(t, loaded.Queued)
+
+	// once it starts the run is no longer queued
+	jr.Queued = false
+	assert.NoError(t, InsertOrUpdateJobRun(db, jr))
+	assert.NoError(t, db.QueryRow("SELECT is_running, is_queued FROM log WHERE id = ?", jr.LogEntryId).Scan(&isRunning, &isQueued))
+	assert.Equal(t, 1, isRunning)
+	assert.Equal(t, 0, isQueued)
+}
+
+func TestInsertLogLines(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var lines []LogLine
+	for i := 1; i <= 2*logLinesBatchSize+1; i++ {
+		lines = append(lines, LogLine{JobRunID: 1, LineNumber: i, Timestamp: time.Now().Format(time.RFC3339Nano), Content: fmt.Sprintf("line %d", i), Stream: "stdout"})
+	}
+	assert.NoError(t, InsertLogLines(db, lines))
+
+	stored, err := GetLogLines(db, 1, 0)
+	assert.NoError(t, err)
+	assert.Len(t, stored, len(lines))
+	assert.Equal(t, "line 201", stored[200].Content)
+
+	// a failing batch doesn't leave any lines behind
+	assert.Error(t, InsertLogLines(db, []LogLine{
+		{JobRunID: 2, LineNumber: 1, Content: "new", Stream: "stdout"},
+		{JobRunID: 1, LineNumber: 1, Content: "duplicate", Stream: "stdout"},
+	}))
+	stored, err = GetLogLines(db, 2, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, stored)
+}
@@ -3,12 +3,18 @@ package cheek
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"gopkg.in/yaml.v3"
@@ -16,6 +22,8 @@ import (
 
 type TemplateData struct {
 	Name string
+	// BasePath is the path the UI is served under, for links to start with
+	BasePath string
 }
 type Response struct {
 	Job    string `json:"jobs,omitempty"`
@@ -23,12 +31,23 @@ type Response struct {
 	Type   string `json:"type,omitempty"`
 }
 
+// streamPollInterval is how often streams check for new output of a run.
+const streamPollInterval = 500 * time.Millisecond
+
 // This will be injected at build time
 var (
 	version   string
 	commitSHA string
 )
 
+// TriggerResponse holds the id of a triggered run, and the run itself
+// if the trigger waited for it to finish.
+type TriggerResponse struct {
+	Response
+	RunId int     `json:"run_id"`
+	Run   *JobRun `json:"run,omitempty"`
+}
+
 type VersionResponse struct {
 	Version   string `json:"version"`
 	CommitSHA string `json:"commit_sha"`
@@ -40,6 +59,36 @@ type ScheduleStatusResponse struct {
 	HasFailedRuns  bool           `json:"has_failed_runs,omitempty"`
 }
 
+// StatsResponse holds the stats of a job, or of all jobs together
+// with the stats per job.
+type StatsResponse struct {
+	Job    string    `json:"job,omitempty"`
+	Window string    `json:"window"`
+	Since  time.Time `json:"since"`
+	RunStats
+	Jobs map[string]RunStats `json:"jobs,omitempty"`
+}
+
+type ScheduleQueueResponse struct {
+	QueueStatus
+	Groups map[string]GroupStatus `json:"groups,omitempty"`
+	// Jobs holds the runs that wait for a previous run of their job
+	// under the queue policy
+	Jobs map[string]JobQueueStatus `json:"jobs,omitempty"`
+}
+
+type JobQueueStatus struct {
+	Depth int         `json:"depth"`
+	Runs  []QueuedRun `json:"runs"`
+}
+
+type GroupStatus struct {
+	Capacity int         `json:"capacity"`
+	Running  int         `json:"running"`
+	Depth    int         `json:"depth"`
+	Runs     []QueuedRun `json:"runs"`
+}
+
 //go:embed web_assets
 var files embed.FS
 
@@ -52,30 +101,45 @@ func fsys() fs.FS {
 	return fsys
 }
 
-func setupRouter(s *Schedule) *httprouter.Router {
+func setupRouter(s *Schedule) http.Handler {
 	router := httprouter.New()
 
 	// ui endpoints
 	router.GET("/jobs/:jobId/:jobRunId", getJobDetailPage(s))
 	router.GET("/core/logs", getCoreLogsPage())
+	router.GET("/search", getSearchPage())
 	router.GET("/", getHomePage())
 
 	// api endpoints
 	router.GET("/healthz/", getHealthCheck)
 	router.GET("/api/jobs", getJobs(s))
 	router.GET("/api/jobs/:jobId", getJob(s))
+	router.GET("/api/jobs/:jobId/runs", getJobRuns(s))
+	router.GET("/api/jobs/:jobId/stats", getJobStats(s))
 	router.GET("/api/jobs/:jobId/runs/:jobRunId", getJobRun(s))
+	router.GET("/api/jobs/:jobId/runs/:jobRunId/stream", getJobRunStream(s))
 	router.POST("/api/jobs/:jobId/trigger", postTrigger(s))
+	router.POST("/api/jobs/:jobId/runs/:jobRunId/cancel", postCancel(s))
+	router.GET("/api/runs", getRuns(s))
+	router.GET("/api/stats", getStats(s))
 	router.GET("/api/core/logs", getCoreLogs(s))
+	router.GET("/api/search", getSearch(s))
 	router.GET("/api/schedule/status", getScheduleStatus(s))
+	router.GET("/api/schedule/queue", getScheduleQueue(s))
 	router.GET("/api/version", getVersion) // Add version endpoint
 
+	if s.metrics == nil {
+		s.metrics = newMetrics(s)
+	}
+	router.Handler("GET", "/metrics", s.metrics.handler())
+
 	fileServer := http.FileServer(http.FS(fsys()))
 	router.GET("/static/*filepath", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		fileServer.ServeHTTP(w, r)
 	})
 
-	return router
+	a := &authenticator{s: s}
+	return withBasePath(s.cfg.BasePath, a.middleware(router))
 }
 
 func getCoreLogsPage() httprouter.Handle {
@@ -85,7 +149,22 @@ func getCoreLogsPage() httprouter.Handle {
 	}
 
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		err := tmpl.ExecuteTemplate(w, "base.html", nil)
+		err := tmpl.ExecuteTemplate(w, "base.html", TemplateData{BasePath: requestBasePath(r)})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func getSearchPage() httprouter.Handle {
+	tmpl, err := template.ParseFS(fsys(), "templates/search.html", "templates/base.html")
+	if err != nil {
+		panic(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		err := tmpl.ExecuteTemplate(w, "base.html", TemplateData{BasePath: requestBasePath(r)})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -101,7 +180,7 @@ func getHomePage() httprouter.Handle {
 	}
 
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		err := tmpl.ExecuteTemplate(w, "base.html", nil)
+		err := tmpl.ExecuteTemplate(w, "base.html", TemplateData{BasePath: requestBasePath(r)})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -117,13 +196,13 @@ func getJobDetailPage(s *Schedule) httprouter.Handle {
 
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		jobId := ps.ByName("jobId")
-		_, ok := s.Jobs[jobId]
+		_, ok := s.job(jobId)
 		if !ok {
 			http.Error(w, fmt.Errorf("job %s not found", jobId).Error(), http.StatusNotFound)
 			return
 		}
 
-		err := tmpl.ExecuteTemplate(w, "base.html", nil)
+		err := tmpl.ExecuteTemplate(w, "base.html", TemplateData{BasePath: requestBasePath(r)})
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -131,14 +210,6 @@ func getJobDetailPage(s *Schedule) httprouter.Handle {
 	}
 }
 
-func server(s *Schedule) {
-	httpAddr := fmt.Sprintf(":%s", s.cfg.Port)
-	router := setupRouter(s)
-
-	s.log.Info().Msgf("Starting HTTP server on %v", httpAddr)
-	log.Fatal(http.ListenAndServe(httpAddr, router))
-}
-
 func getHealthCheck(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	status := Response{Status: "ok"}
 	w.Header().Set("Content-Type", "application/json")
@@ -150,11 +221,12 @@ func getHealthCheck(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 func getJobs(s *Schedule) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		w.Header().Set("Content-Type", "application/json")
-		for _, j := range s.Jobs {
-			j.loadRunsFromDb(10, false)
+		jobs := s.jobs()
+		for _, j := range jobs {
+			j.loadRuns(10, false)
 		}
 
-		if err := json.NewEncoder(w).Encode(s.Jobs); err != nil {
+		if err := json.NewEncoder(w).Encode(jobs); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}
@@ -164,12 +236,13 @@ func getScheduleStatus(s *Schedule) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		w.Header().Set("Content-Type", "application/json")
 
+		jobs := s.jobs()
 		ssr := ScheduleStatusResponse{
-			Status: make(map[string]int, len(s.Jobs)),
+			Status: make(map[string]int, len(jobs)),
 		}
 
-		for _, j := range s.Jobs {
-			j.loadRunsFromDb(1, false)
+		for _, j := range jobs {
+			j.loadRuns(1, false)
 			lastRunStatus := j.Runs[0].Status
 			ssr.Status[j.Name] = *lastRunStatus
 			if *lastRunStatus == 1 {
@@ -184,11 +257,58 @@ func getScheduleStatus(s *Schedule) httprouter.Handle {
 		}
 	}
 }
+
+func getScheduleQueue(s *Schedule) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var sqr ScheduleQueueResponse
+		if s.pool != nil {
+			sqr.QueueStatus = s.pool.status()
+		}
+
+		// the map of groups gets replaced on reload, not modified
+		s.mu.RLock()
+		groups := s.groups
+		s.mu.RUnlock()
+		if len(groups) > 0 {
+			sqr.Groups = make(map[string]GroupStatus, len(groups))
+		}
+		for name, g := range groups {
+			qs := g.status()
+			sqr.Groups[name] = GroupStatus{Capacity: qs.MaxParallelJobs, Running: qs.Running, Depth: qs.Depth, Runs: qs.Runs}
+		}
+
+		for name, j := range s.jobs() {
+			if runs := j.runState().queuedRuns(); len(runs) > 0 {
+				if sqr.Jobs == nil {
+					sqr.Jobs = map[string]JobQueueStatus{}
+				}
+				sqr.Jobs[name] = JobQueueStatus{Depth: len(runs), Runs: runs}
+			}
+		}
+
+		if err := json.NewEncoder(w).Encode(sqr); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
 func getCoreLogs(s *Schedule) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		w.Header().Set("Content-Type", "application/json")
 
-		logs, err := getCoreLogsFromDB(s.cfg.DB, 120)
+		q, err := coreLogQuery(r)
+		if err != nil {
+			status := Response{Status: fmt.Sprintf("error: %s", err), Type: "core logs"}
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		logs, err := s.cfg.Store.CoreLogs(q)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -200,10 +320,272 @@ func getCoreLogs(s *Schedule) httprouter.Handle {
 	}
 }
 
+// coreLogQuery reads the filters on core logs from the query string.
+func coreLogQuery(r *http.Request) (CoreLogQuery, error) {
+	params := r.URL.Query()
+	q := CoreLogQuery{
+		Level:  params.Get("level"),
+		Job:    params.Get("job"),
+		Search: params.Get("q"),
+	}
+
+	var err error
+	if q.Since, err = ParseTime(params.Get("since")); err != nil {
+		return q, fmt.Errorf("since: %w", err)
+	}
+	if q.Until, err = ParseTime(params.Get("until")); err != nil {
+		return q, fmt.Errorf("until: %w", err)
+	}
+	if v := params.Get("before"); v != "" {
+		if q.Before, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("before: %w", err)
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("limit: %w", err)
+		}
+	}
+	return q, q.validate()
+}
+
+func getSearch(s *Schedule) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		q, err := searchQuery(r)
+		if err != nil {
+			status := Response{Status: fmt.Sprintf("error: %s", err), Type: "search"}
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		results, err := s.cfg.Store.Search(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// searchQuery reads a search of run output from the query string.
+func searchQuery(r *http.Request) (SearchQuery, error) {
+	params := r.URL.Query()
+	q := SearchQuery{
+		Query: params.Get("q"),
+		Job:   params.Get("job"),
+	}
+
+	var err error
+	if q.Since, err = ParseTime(params.Get("since")); err != nil {
+		return q, fmt.Errorf("since: %w", err)
+	}
+	if q.Until, err = ParseTime(params.Get("until")); err != nil {
+		return q, fmt.Errorf("until: %w", err)
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("limit: %w", err)
+		}
+	}
+	return q, q.validate()
+}
+
+func getRuns(s *Schedule) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		q, err := runQuery(r)
+		q.Job = r.URL.Query().Get("job")
+		writeRuns(w, s, q, err)
+	}
+}
+
+func getJobRuns(s *Schedule) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		jobId := ps.ByName("jobId")
+		if _, ok := s.job(jobId); !ok {
+			status := Response{Job: jobId, Status: "error: can't find job to get runs", Type: "runs"}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		q, err := runQuery(r)
+		q.Job = jobId
+		writeRuns(w, s, q, err)
+	}
+}
+
+// writeRuns writes a page of the runs matching the query, or
+// the error the query couldn't be read with.
+func writeRuns(w http.ResponseWriter, s *Schedule, q RunQuery, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		status := Response{Job: q.Job, Status: fmt.Sprintf("error: %s", err), Type: "runs"}
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	page, err := s.cfg.Store.Runs(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// runQuery reads the filters on the history of runs from the query string,
+// filters that take several values accept them comma separated or repeated.
+func runQuery(r *http.Request) (RunQuery, error) {
+	params := r.URL.Query()
+	q := RunQuery{
+		Status:      listParam(params, "status"),
+		TriggeredBy: listParam(params, "triggered_by"),
+		Sort:        params.Get("sort"),
+	}
+
+	var err error
+	if q.Since, err = ParseTime(params.Get("since")); err != nil {
+		return q, fmt.Errorf("since: %w", err)
+	}
+	if q.Until, err = ParseTime(params.Get("until")); err != nil {
+		return q, fmt.Errorf("until: %w", err)
+	}
+	if v := params.Get("min_duration"); v != "" {
+		if q.MinDuration, err = ParseWindow(v); err != nil {
+			return q, fmt.Errorf("min_duration: %w", err)
+		}
+	}
+	if v := params.Get("cursor"); v != "" {
+		if q.After, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("cursor: %w", err)
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, fmt.Errorf("limit: %w", err)
+		}
+	}
+	return q, q.validate()
+}
+
+// listParam returns the values of a query parameter that
+// are given comma separated, repeated or both.
+func listParam(params url.Values, key string) []string {
+	var values []string
+	for _, v := range params[key] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+func getStats(s *Schedule) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+
+		sr, err := statsWindow(r)
+		if err != nil {
+			status := Response{Status: fmt.Sprintf("error: %s", err), Type: "stats"}
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if sr.RunStats, err = s.cfg.Store.Stats("", sr.Since); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jobs := s.jobs()
+		sr.Jobs = make(map[string]RunStats, len(jobs))
+		for name := range jobs {
+			if sr.Jobs[name], err = s.cfg.Store.Stats(name, sr.Since); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := json.NewEncoder(w).Encode(sr); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+func getJobStats(s *Schedule) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		jobId := ps.ByName("jobId")
+		w.Header().Set("Content-Type", "application/json")
+
+		if _, ok := s.job(jobId); !ok {
+			status := Response{Job: jobId, Status: "error: can't find job to get stats", Type: "stats"}
+			w.WriteHeader(http.StatusNotFound)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		sr, err := statsWindow(r)
+		if err != nil {
+			status := Response{Job: jobId, Status: fmt.Sprintf("error: %s", err), Type: "stats"}
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		sr.Job = jobId
+		if sr.RunStats, err = s.cfg.Store.Stats(jobId, sr.Since); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(sr); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// statsWindow reads the period to compute stats over from the query string.
+func statsWindow(r *http.Request) (StatsResponse, error) {
+	sr := StatsResponse{Window: r.URL.Query().Get("window")}
+	if sr.Window == "" {
+		sr.Window = defaultStatsWindow
+	}
+	d, err := ParseWindow(sr.Window)
+	if err != nil {
+		return sr, fmt.Errorf("window: %w", err)
+	}
+	sr.Since = time.Now().Add(-d).UTC()
+	return sr, nil
+}
+
 func getJob(s *Schedule) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		jobId := ps.ByName("jobId")
-		job, ok := s.Jobs[jobId]
+		job, ok := s.job(jobId)
 
 		if !ok {
 			status := Response{Job: jobId, Status: "error: can't find job to get runs", Type: "runs"}
@@ -228,7 +610,7 @@ func getJob(s *Schedule) httprouter.Handle {
 		}
 
 		// get job runs from db
-		job.loadRunsFromDb(50, false)
+		job.loadRuns(50, false)
 
 		job.Yaml = string(jobYaml)
 
@@ -246,7 +628,7 @@ func getJobRun(s *Schedule) httprouter.Handle {
 		runId := ps.ByName("jobRunId")
 
 		runIdInt, err := strconv.Atoi(runId)
-		job, ok := s.Jobs[jobId]
+		job, ok := s.job(jobId)
 
 		if !ok || err != nil {
 			status := Response{Job: jobId, Status: "error: can't find job / id to get runs", Type: "runs"}
@@ -258,7 +640,7 @@ func getJobRun(s *Schedule) httprouter.Handle {
 			return
 		}
 
-		jr, err := job.loadLogFromDb(runIdInt)
+		jr, err := job.loadRun(runIdInt)
 		if err != nil {
 			status := Response{Job: jobId, Status: "error: can't find job / id to get runs", Type: "runs"}
 			w.Header().Set("Content-Type", "application/json")
@@ -276,10 +658,97 @@ func getJobRun(s *Schedule) httprouter.Handle {
 	}
 }
 
+// getJobRunStream streams the output of a job run as server-sent events
+// until the run is done. Each line is sent as a "line" event with the
+// line number as id, which allows clients to resume via Last-Event-ID.
+func getJobRunStream(s *Schedule) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		jobId := ps.ByName("jobId")
+		runId, err := strconv.Atoi(ps.ByName("jobRunId"))
+		_, ok := s.job(jobId)
+
+		if !ok || err != nil || s.cfg.Store == nil {
+			status := Response{Job: jobId, Status: "error: can't find job / id to stream", Type: "stream"}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if _, err := s.cfg.Store.IsJobRunActive(jobId, runId); err != nil {
+			status := Response{Job: jobId, Status: "error: can't find job / id to stream", Type: "stream"}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		lastLine, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(streamPollInterval)
+		defer ticker.Stop()
+
+		for {
+			// check the state before reading the lines, so
+			// no lines get lost once the run is done
+			active, err := s.cfg.Store.IsJobRunActive(jobId, runId)
+			if err != nil {
+				s.log.Warn().Str("job", jobId).Err(err).Msg("Couldn't load job run state.")
+				return
+			}
+
+			lines, err := s.cfg.Store.LogLines(runId, lastLine)
+			if err != nil {
+				s.log.Warn().Str("job", jobId).Err(err).Msg("Couldn't load job output.")
+				return
+			}
+			for _, l := range lines {
+				data, err := json.Marshal(l)
+				if err != nil {
+					return
+				}
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: line\ndata: %s\n\n", l.LineNumber, data); err != nil {
+					return
+				}
+				lastLine = l.LineNumber
+			}
+
+			if !active {
+				_, _ = fmt.Fprint(w, "event: done\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			flusher.Flush()
+
+			select {
+			case <-ticker.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
+
 func postTrigger(s *Schedule) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		jobId := ps.ByName("jobId")
-		job, ok := s.Jobs[jobId]
+		job, ok := s.job(jobId)
 
 		if !ok {
 			status := Response{Job: jobId, Status: "error: can't find job to trigger", Type: "trigger"}
@@ -291,16 +760,153 @@ func postTrigger(s *Schedule) httprouter.Handle {
 			return
 		}
 
-		job.execCommandWithRetry("ui") // trigger
+		wait, timeout, err := triggerWait(r)
+		if err != nil {
+			status := Response{Job: jobId, Status: fmt.Sprintf("error: %s", err), Type: "trigger"}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		params, err := triggerParams(r)
+		if err == nil {
+			params, err = job.resolveParams(params)
+		}
+		if err != nil {
+			status := Response{Job: jobId, Status: fmt.Sprintf("error: %s", err), Type: "trigger"}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		jr := job.setup("ui", params)
+		done := s.launch(job, jr)
+
+		tr := TriggerResponse{Response: Response{Job: jobId, Status: "ok", Type: "trigger"}, RunId: jr.LogEntryId}
+		code := http.StatusAccepted
+		if wait {
+			var expired <-chan time.Time
+			if timeout > 0 {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				expired = timer.C
+			}
+			select {
+			case jr := <-done:
+				tr.Run = &jr
+				code = http.StatusOK
+			case <-expired:
+			case <-r.Context().Done():
+				return
+			}
+		}
 
-		status := Response{Job: jobId, Status: "ok", Type: "trigger"}
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", fmt.Sprintf("%s/api/jobs/%s/runs/%d", requestBasePath(r), url.PathEscape(jobId), jr.LogEntryId))
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(tr); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// postCancel cancels a queued or executing run of a job, it returns before
+// the run has stopped as the job gets kill_grace to exit.
+func postCancel(s *Schedule) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		jobId := ps.ByName("jobId")
+		runId, err := strconv.Atoi(ps.ByName("jobRunId"))
+		job, ok := s.job(jobId)
+
+		code, status := http.StatusAccepted, Response{Job: jobId, Status: "ok", Type: "cancel"}
+		switch {
+		case !ok || err != nil:
+			code, status.Status = http.StatusNotFound, "error: can't find job / id to cancel"
+		case s.CancelRun(jobId, runId):
+			s.log.Info().Str("job", jobId).Int("run", runId).Msg("Run cancelled")
+		default:
+			// runs are looked up by id, which doesn't tell whether they're of this job
+			if jr, err := job.loadRun(runId); err != nil || jr.Name != jobId {
+				code, status.Status = http.StatusNotFound, "error: can't find job / id to cancel"
+			} else {
+				code, status.Status = http.StatusConflict, "error: run is not active"
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
 		if err := json.NewEncoder(w).Encode(status); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}
 }
 
+// triggerParams reads the param values of a trigger from the request body,
+// either a JSON object or a form.
+func triggerParams(r *http.Request) (RunParams, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct != "application/json" {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		params := RunParams{}
+		for name := range r.PostForm {
+			params[name] = r.PostForm.Get(name)
+		}
+		return params, nil
+	}
+
+	var body map[string]any
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("params should be a JSON object: %w", err)
+	}
+	params := RunParams{}
+	for name, v := range body {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			params[name] = v
+		case json.Number, bool:
+			params[name] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("param '%s' should be a string, number or boolean", name)
+		}
+	}
+	return params, nil
+}
+
+// triggerWait reads whether a trigger should wait for the run to finish,
+// and for how long at most, 0 meaning as long as the run takes.
+func triggerWait(r *http.Request) (bool, time.Duration, error) {
+	params := r.URL.Query()
+	var wait bool
+	if v := params.Get("wait"); v != "" {
+		var err error
+		if wait, err = strconv.ParseBool(v); err != nil {
+			return false, 0, fmt.Errorf("wait should be true or false")
+		}
+	}
+	var timeout time.Duration
+	if v := params.Get("timeout"); v != "" {
+		var err error
+		if timeout, err = time.ParseDuration(v); err != nil || timeout < 0 {
+			return false, 0, fmt.Errorf("timeout should be a duration such as 30s or 5m")
+		}
+	}
+	return wait, timeout, nil
+}
+
 func getVersion(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	versionResponse := VersionResponse{Version: version, CommitSHA: commitSHA}
 	w.Header().Set("Content-Type", "application/json")
@@ -1,12 +1,18 @@
 package cheek
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestMux(t *testing.T) {
@@ -137,7 +143,7 @@ func TestMux(t *testing.T) {
 		},
 		{
 			schedule: &s2,
-			name:     "/trigger/ must return 200",
+			name:     "/trigger/ must return 202",
 			args: func(*testing.T) args {
 				req, err := http.NewRequest("POST", "/api/jobs/bertha/trigger", nil)
 				if err != nil {
@@ -147,7 +153,7 @@ func TestMux(t *testing.T) {
 					req: req,
 				}
 			},
-			wantCode: http.StatusOK,
+			wantCode: http.StatusAccepted,
 			wantBody: "\"status\":\"ok\",\"type\":\"trigger\"",
 		},
 		{
@@ -195,6 +201,21 @@ func TestMux(t *testing.T) {
 			wantCode: http.StatusOK,
 			wantBody: "{}",
 		},
+		{
+			schedule: &s1,
+			name:     "/api/schedule/queue must return 200",
+			args: func(*testing.T) args {
+				req, err := http.NewRequest("GET", "/api/schedule/queue", nil)
+				if err != nil {
+					t.Fatalf("fail to create request: %s", err.Error())
+				}
+				return args{
+					req: req,
+				}
+			},
+			wantCode: http.StatusOK,
+			wantBody: `"depth":0`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -216,3 +237,143 @@ func TestMux(t *testing.T) {
 		})
 	}
 }
+
+func TestJobRunStream(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	cfg := NewConfig()
+	cfg.Store = NewSQLiteStore(db)
+	j := &JobSpec{Name: "test", cfg: cfg}
+	s := &Schedule{Jobs: map[string]*JobSpec{"test": j}, cfg: cfg, log: zerolog.Nop()}
+
+	jr := &JobRun{Name: "test", TriggeredAt: time.Now(), TriggeredBy: "test"}
+	assert.NoError(t, InsertOrUpdateJobRun(db, jr))
+	assert.NoError(t, InsertLogLine(db, jr.LogEntryId, 1, "first", "stdout"))
+	assert.NoError(t, InsertLogLine(db, jr.LogEntryId, 2, "second", "stderr"))
+
+	srv := httptest.NewServer(setupRouter(s))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/jobs/test/runs/%d/stream", srv.URL, jr.LogEntryId), nil)
+	assert.NoError(t, err)
+	// resume after the first line
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				events <- line
+			}
+		}
+	}()
+
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event received")
+			return ""
+		}
+	}
+
+	assert.Equal(t, "id: 2", next())
+	assert.Equal(t, "event: line", next())
+	assert.Contains(t, next(), `"content":"second"`)
+
+	// lines written while the run is active get streamed, until it's done
+	assert.NoError(t, InsertLogLine(db, jr.LogEntryId, 3, "third", "stdout"))
+	status := StatusOK
+	jr.Status = &status
+	assert.NoError(t, InsertOrUpdateJobRun(db, jr))
+
+	assert.Equal(t, "id: 3", next())
+	assert.Equal(t, "event: line", next())
+	assert.Contains(t, next(), `"content":"third"`)
+	assert.Equal(t, "event: done", next())
+	assert.Equal(t, "data: {}", next())
+
+	_, open := <-events
+	assert.False(t, open, "stream should end once the run is done")
+}
+
+func TestJobRunStreamNotFound(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := NewConfig()
+	cfg.Store = NewSQLiteStore(db)
+	s := &Schedule{Jobs: map[string]*JobSpec{"test": {Name: "test", cfg: cfg}}, cfg: cfg}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/jobs/test/runs/42/stream", nil)
+	setupRouter(s).ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestTrigger(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, `
+jobs:
+  slow:
+    command: [sh, -c, "sleep 0.5 && echo done"]
+`)
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	s, err := loadSchedule(zerolog.Nop(), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trigger := func(url string) (*httptest.ResponseRecorder, TriggerResponse) {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, nil)
+		setupRouter(s).ServeHTTP(resp, req)
+		var tr TriggerResponse
+		if resp.Code < 300 {
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tr))
+		}
+		return resp, tr
+	}
+
+	// the run is enqueued right away
+	start := time.Now()
+	resp, tr := trigger("/api/jobs/slow/trigger")
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.NotZero(t, tr.RunId)
+	assert.Nil(t, tr.Run)
+	assert.Equal(t, fmt.Sprintf("/api/jobs/slow/runs/%d", tr.RunId), resp.Header().Get("Location"))
+	jr, err := cfg.Store.JobRun("slow", tr.RunId)
+	assert.NoError(t, err)
+	assert.Equal(t, "ui", jr.TriggeredBy)
+
+	// or waited for
+	resp, tr = trigger("/api/jobs/slow/trigger?wait=true")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	if assert.NotNil(t, tr.Run) {
+		assert.Equal(t, tr.RunId, tr.Run.LogEntryId)
+		assert.Equal(t, StatusOK, *tr.Run.Status)
+		assert.Contains(t, tr.Run.Log, "done")
+	}
+
+	// for at most the timeout
+	resp, tr = trigger("/api/jobs/slow/trigger?wait=true&timeout=50ms")
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.NotZero(t, tr.RunId)
+	assert.Nil(t, tr.Run)
+
+	for _, url := range []string{"/api/jobs/slow/trigger?wait=maybe", "/api/jobs/slow/trigger?wait=true&timeout=soon"} {
+		resp, _ := trigger(url)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, url)
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"os/exec"
+	"slices"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/adhocore/gronx"
@@ -18,10 +21,52 @@ import (
 
 // Global status constants
 const (
-	StatusOK    int = 0
-	StatusError int = -1
+	StatusOK      int = 0
+	StatusError   int = -1
+	StatusTimeout int = -2
+	StatusSkipped int = -3
+	// StatusCancelled marks runs that got cancelled via the UI, API or CLI,
+	// or that got replaced by a newer run
+	StatusCancelled int = -4
 )
 
+// defaultKillGrace is how long a job gets to exit after
+// being asked to terminate before it gets killed.
+const defaultKillGrace = 10 * time.Second
+
+// Retry backoff strategies
+const (
+	BackoffFixed       = "fixed"
+	BackoffExponential = "exponential"
+)
+
+// defaultRetryDelay is the delay between retries if not set explicitly.
+const defaultRetryDelay = 5 * time.Second
+
+// defaultRetryMaxDelay caps exponential backoff if max_delay isn't set.
+const defaultRetryMaxDelay = time.Hour
+
+// errJobTimeout is the cancellation cause of runs that exceed their timeout.
+var errJobTimeout = errors.New("job timed out")
+
+// errJobCancelled is the cancellation cause of runs that get cancelled by hand.
+var errJobCancelled = errors.New("cancellation")
+
+// Misfire policies, these define what happens with
+// runs that were missed while cheek was not running.
+const (
+	MisfireSkip    = "skip"
+	MisfireRunOnce = "run_once"
+	MisfireRunAll  = "run_all"
+)
+
+// defaultMisfireMaxRuns caps the number of catch-up runs
+// for the run_all misfire policy if not set explicitly.
+const defaultMisfireMaxRuns = 10
+
+// triggerCatchup is the trigger of runs that catch up on missed ticks.
+const triggerCatchup = "catchup"
+
 // OnEvent contains specs on what needs to happen after a job event.
 type OnEvent struct {
 	TriggerJob           []string `yaml:"trigger_job,omitempty" json:"trigger_job,omitempty"`
@@ -39,19 +84,42 @@ type JobSpec struct {
 
 	OnSuccess OnEvent `yaml:"on_success,omitempty" json:"on_success,omitempty"`
 	OnError   OnEvent `yaml:"on_error,omitempty" json:"on_error,omitempty"`
+	OnTimeout OnEvent `yaml:"on_timeout,omitempty" json:"on_timeout,omitempty"`
 
 	Name                       string            `json:"name"`
 	Retries                    int               `yaml:"retries,omitempty" json:"retries,omitempty"`
+	RetryDelay                 time.Duration     `yaml:"retry_delay,omitempty" json:"retry_delay,omitempty"`
+	RetryBackoff               string            `yaml:"retry_backoff,omitempty" json:"retry_backoff,omitempty"`
+	RetryMaxDelay              time.Duration     `yaml:"max_delay,omitempty" json:"max_delay,omitempty"`
+	RetryJitter                float64           `yaml:"retry_jitter,omitempty" json:"retry_jitter,omitempty"`
+	RetryOnExitCodes           []int             `yaml:"retry_on_exit_codes,omitempty" json:"retry_on_exit_codes,omitempty"`
+	NoRetryOnExitCodes         []int             `yaml:"no_retry_on_exit_codes,omitempty" json:"no_retry_on_exit_codes,omitempty"`
 	Env                        map[string]secret `yaml:"env,omitempty"`
 	WorkingDirectory           string            `yaml:"working_directory,omitempty" json:"working_directory,omitempty"`
 	DisableConcurrentExecution bool              `yaml:"disable_concurrent_execution,omitempty" json:"disable_concurrent_execution,omitempty"`
+	ConcurrencyPolicy          string            `yaml:"concurrency_policy,omitempty" json:"concurrency_policy,omitempty"`
+	MaxQueued                  int               `yaml:"max_queued,omitempty" json:"max_queued,omitempty"`
+	Priority                   int               `yaml:"priority,omitempty" json:"priority,omitempty"`
+	Groups                     []string          `yaml:"groups,omitempty" json:"groups,omitempty"`
+	MisfirePolicy              string            `yaml:"misfire_policy,omitempty" json:"misfire_policy,omitempty"`
+	MisfireMaxRuns             int               `yaml:"misfire_max_runs,omitempty" json:"misfire_max_runs,omitempty"`
+	MisfireGrace               time.Duration     `yaml:"misfire_grace,omitempty" json:"misfire_grace,omitempty"`
+	TZLocation                 string            `yaml:"tz_location,omitempty" json:"tz_location,omitempty"`
+	Timeout                    time.Duration     `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	KillGrace                  time.Duration     `yaml:"kill_grace,omitempty" json:"kill_grace,omitempty"`
+	Retention                  Retention         `yaml:"retention,omitempty" json:"retention,omitempty"`
+	Params                     []Param           `yaml:"params,omitempty" json:"params,omitempty"`
 	globalSchedule             *Schedule
 	Runs                       []JobRun `json:"runs" yaml:"-"`
 
 	nextTick time.Time
+	loc      *time.Location
+	spec     string
 	log      zerolog.Logger
 	cfg      Config
-	mutex    sync.Mutex
+	state    *jobState
+	// mutex guards the lazy initialization of state
+	mutex sync.Mutex
 }
 
 type secret string
@@ -65,6 +133,7 @@ func (secret) MarshalText() ([]byte, error) {
 type JobRun struct {
 	LogEntryId  int  `json:"id,omitempty" db:"id"`
 	Status      *int `json:"status,omitempty" db:"status,omitempty"`
+	Queued      bool `json:"queued,omitempty" db:"is_queued"`
 	logBuf      bytes.Buffer
 	Log         string        `json:"log" db:"message"`
 	Name        string        `json:"name" db:"job"`
@@ -72,39 +141,43 @@ type JobRun struct {
 	TriggeredBy string        `json:"triggered_by" db:"triggered_by,omitempty"`
 	Triggered   []string      `json:"triggered,omitempty"`
 	Duration    time.Duration `json:"duration,omitempty" db:"duration"`
+	Params      RunParams     `json:"params,omitempty" db:"params"`
 	jobRef      *JobSpec
+	// lines is the number of output lines captured so far
+	lines int
 }
 
 func (jr *JobRun) flushLogBuffer() {
 	jr.Log = jr.logBuf.String()
 }
 
-func (j *JobSpec) setup(trigger string) JobRun {
+func (j *JobSpec) setup(trigger string, params RunParams) JobRun {
 	// Initialize the JobRun before executing the command
 	jr := JobRun{
 		Name:        j.Name,
 		TriggeredAt: j.now(),
 		TriggeredBy: trigger,
 		Status:      nil,
+		Params:      params,
 		jobRef:      j,
 	}
 
-	// Log the job run immediately to the database to mark the job as started
-	jr.logToDb()
+	// Save the job run immediately to mark the job as started
+	jr.save()
 
 	return jr
 }
 
-func (jr *JobRun) logToDb() {
-	if jr.jobRef.cfg.DB == nil {
-		jr.jobRef.log.Warn().Str("job", jr.Name).Msg("No db connection, not saving job log to db.")
+func (jr *JobRun) save() {
+	if jr.jobRef.cfg.Store == nil {
+		jr.jobRef.log.Warn().Str("job", jr.Name).Msg("No store configured, not saving job run.")
 		return
 	}
 
-	err := InsertOrUpdateJobRun(jr.jobRef.cfg.DB, jr)
+	err := jr.jobRef.cfg.Store.SaveJobRun(jr)
 	if err != nil {
 		if jr.jobRef.globalSchedule != nil {
-			jr.jobRef.globalSchedule.log.Warn().Str("job", jr.Name).Err(err).Msg("Couldn't save job log to db.")
+			jr.jobRef.globalSchedule.log.Warn().Str("job", jr.Name).Err(err).Msg("Couldn't save job run.")
 		} else {
 			panic(err)
 		}
@@ -114,12 +187,8 @@ func (jr *JobRun) logToDb() {
 func (j *JobSpec) finalize(jr *JobRun) {
 	// flush logbuf to string
 	jr.flushLogBuffer()
-	// write logs to disk
-	jr.logToDb()
-	// if no DB, store run in memory for testing/debugging
-	if j.cfg.DB == nil {
-		j.Runs = append(j.Runs, *jr)
-	}
+	// write logs to the store
+	jr.save()
 	// launch on_events
 	j.OnEvent(jr)
 }
@@ -129,18 +198,22 @@ func (j *JobSpec) execCommandWithRetry(trigger string) JobRun {
 }
 
 func (j *JobSpec) execCommandWithRetryContext(ctx context.Context, trigger string) JobRun {
-	tries := 0
-	var jr JobRun
-	const timeOut = 5 * time.Second
-
 	// Initialize the JobRun with the first trigger
-	jr = j.setup(trigger)
+	jr := j.setup(trigger, j.defaultParams())
+
+	return j.execWithRetries(ctx, jr)
+}
+
+// execWithRetries executes a job run that has been set up, retrying it on failure.
+func (j *JobSpec) execWithRetries(ctx context.Context, jr JobRun) JobRun {
+	tries := 0
+	trigger := jr.TriggeredBy
 
-	for tries < j.Retries+1 {
+	for {
 		// Check if context is cancelled before starting
 		if ctx.Err() != nil {
-			jr.Log = "Job cancelled due to scheduler shutdown"
-			exitCode := StatusError
+			jr.logBuf.WriteString(fmt.Sprintf("Job cancelled due to %s", cancelReason(ctx)))
+			exitCode := cancelStatus(ctx)
 			jr.Status = &exitCode
 			j.finalize(&jr)
 			return jr
@@ -158,23 +231,39 @@ func (j *JobSpec) execCommandWithRetryContext(ctx context.Context, trigger strin
 		// Finalize logging, etc.
 		j.finalize(&jr)
 
-		if *jr.Status == StatusOK {
-			// Exit if the job succeeded (Status 0)
+		if *jr.Status == StatusOK || *jr.Status == StatusCancelled || tries >= j.Retries {
+			// Exit if the job succeeded (Status 0), got cancelled or no retries are left
 			break
 		}
 
-		// Log the unsuccessful attempt and retry
-		j.log.Debug().Str("job", j.Name).Int("exitcode", *jr.Status).Msgf("job exited unsuccessfully, launching retry after %v timeout.", timeOut)
+		if !j.shouldRetry(*jr.Status) {
+			j.log.Debug().Str("job", j.Name).Int("exitcode", *jr.Status).Msg("job exited unsuccessfully, not retrying for this exit code.")
+			break
+		}
 
 		// Increment the attempt counter
 		tries++
+		j.metrics().retried(j.Name)
+
+		// Log the unsuccessful attempt and retry
+		delay := j.retryDelay(tries)
+		j.log.Debug().Str("job", j.Name).Int("exitcode", *jr.Status).Msgf("job exited unsuccessfully, launching retry after %v delay.", delay)
 
 		// Sleep with context cancellation check
 		select {
-		case <-time.After(timeOut):
+		case <-time.After(delay):
 			// Continue to retry
 		case <-ctx.Done():
-			jr.Log += "\nJob cancelled during retry timeout"
+			if cancelStatus(ctx) == StatusCancelled {
+				// pending retries are aborted, the run is stored as cancelled
+				jr.logBuf.WriteString(fmt.Sprintf("\nJob cancelled during retry delay due to %s", cancelReason(ctx)))
+				exitCode := StatusCancelled
+				jr.Status = &exitCode
+				jr.flushLogBuffer()
+				jr.save()
+				return jr
+			}
+			jr.Log += fmt.Sprintf("\nJob cancelled during retry delay due to %s", cancelReason(ctx))
 			exitCode := StatusError
 			jr.Status = &exitCode
 			return jr
@@ -184,6 +273,63 @@ func (j *JobSpec) execCommandWithRetryContext(ctx context.Context, trigger strin
 	return jr
 }
 
+// retryDelay returns how long to wait before the given retry (starting at 1).
+func (j *JobSpec) retryDelay(retry int) time.Duration {
+	delay := j.RetryDelay
+	if delay == 0 {
+		delay = defaultRetryDelay
+	}
+
+	if j.RetryBackoff == BackoffExponential {
+		maxDelay := j.RetryMaxDelay
+		if maxDelay == 0 {
+			maxDelay = max(defaultRetryMaxDelay, delay)
+		}
+		// doubling stops at the max, before the delay can overflow
+		for i := 1; i < retry && delay < maxDelay; i++ {
+			if delay > maxDelay/2 {
+				delay = maxDelay
+			} else {
+				delay *= 2
+			}
+		}
+	}
+
+	if j.RetryJitter > 0 {
+		// spread the delay randomly by up to the jitter fraction in either direction
+		delay += time.Duration((rand.Float64()*2 - 1) * j.RetryJitter * float64(delay))
+	}
+
+	if j.RetryMaxDelay > 0 && delay > j.RetryMaxDelay {
+		delay = j.RetryMaxDelay
+	}
+	return delay
+}
+
+// shouldRetry tells whether a failed run with the given exit status should be retried.
+func (j *JobSpec) shouldRetry(status int) bool {
+	if len(j.RetryOnExitCodes) > 0 {
+		return slices.Contains(j.RetryOnExitCodes, status)
+	}
+	return !slices.Contains(j.NoRetryOnExitCodes, status)
+}
+
+func (j *JobSpec) ValidateRetries() error {
+	switch {
+	case j.Retries < 0:
+		return fmt.Errorf("retries for job '%s' cannot be negative", j.Name)
+	case j.RetryBackoff != "" && j.RetryBackoff != BackoffFixed && j.RetryBackoff != BackoffExponential:
+		return fmt.Errorf("retry_backoff '%s' for job '%s' not valid, should be one of %s or %s", j.RetryBackoff, j.Name, BackoffFixed, BackoffExponential)
+	case j.RetryDelay < 0 || j.RetryMaxDelay < 0:
+		return fmt.Errorf("retry_delay and max_delay for job '%s' cannot be negative", j.Name)
+	case j.RetryJitter < 0 || j.RetryJitter > 1:
+		return fmt.Errorf("retry_jitter for job '%s' should be between 0 and 1", j.Name)
+	case len(j.RetryOnExitCodes) > 0 && len(j.NoRetryOnExitCodes) > 0:
+		return fmt.Errorf("job '%s' cannot set both retry_on_exit_codes and no_retry_on_exit_codes", j.Name)
+	}
+	return nil
+}
+
 func (j *JobSpec) now() time.Time {
 	// defer for if schedule doesn't exist, allows for easy testing
 	if j.globalSchedule != nil {
@@ -196,14 +342,62 @@ func (j *JobSpec) execCommand(jr JobRun, trigger string) JobRun {
 	return j.execCommandContext(context.Background(), jr, trigger)
 }
 
+// timeouts returns the timeout and kill grace period that apply to the job,
+// falling back on the schedule's defaults.
+func (j *JobSpec) timeouts() (timeout time.Duration, killGrace time.Duration) {
+	timeout, killGrace = j.Timeout, j.KillGrace
+	if j.globalSchedule != nil {
+		j.globalSchedule.mu.RLock()
+		if timeout == 0 {
+			timeout = j.globalSchedule.Timeout
+		}
+		if killGrace == 0 {
+			killGrace = j.globalSchedule.KillGrace
+		}
+		j.globalSchedule.mu.RUnlock()
+	}
+	if killGrace == 0 {
+		killGrace = defaultKillGrace
+	}
+	return timeout, killGrace
+}
+
+// terminate stops the process group of a running command, first by sending
+// SIGTERM and if it did not exit after the grace period by sending SIGKILL.
+func (j *JobSpec) terminate(cmd *exec.Cmd, killGrace time.Duration, exited <-chan struct{}) {
+	// a negative pid signals the whole process group
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM); err != nil {
+		j.log.Debug().Str("job", j.Name).Err(err).Msg("can't send SIGTERM to job")
+	}
+	select {
+	case <-exited:
+	case <-time.After(killGrace):
+		j.log.Warn().Str("job", j.Name).Msgf("Job still running %v after SIGTERM, sending SIGKILL", killGrace)
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			j.log.Debug().Str("job", j.Name).Err(err).Msg("can't send SIGKILL to job")
+		}
+	}
+}
+
 func (j *JobSpec) execCommandContext(ctx context.Context, jr JobRun, trigger string) JobRun {
 	j.log.Info().Str("job", j.Name).Str("trigger", trigger).Msgf("Job triggered")
 	suppressLogs := j.cfg.SuppressLogs
 
+	timeout, killGrace := j.timeouts()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, errJobTimeout)
+		defer cancel()
+	}
+
+	command, err := j.command(jr.Params)
+	if err == nil && len(command) == 0 {
+		err = errors.New("no command specified")
+	}
+
 	var cmd *exec.Cmd
-	switch len(j.Command) {
-	case 0:
-		err := errors.New("no command specified")
+	switch {
+	case err != nil:
 		jr.Log = fmt.Sprintf("Job unable to start: %v", err.Error())
 		j.log.Warn().Str("job", j.Name).Str("trigger", trigger).Err(err).Msg(jr.Log)
 		if !suppressLogs {
@@ -213,34 +407,41 @@ func (j *JobSpec) execCommandContext(ctx context.Context, jr JobRun, trigger str
 		jr.Status = &errStatus // Set failure status when no command is specified
 
 		return jr
-	case 1:
-		cmd = exec.CommandContext(ctx, j.Command[0])
+	case len(command) == 1:
+		cmd = exec.Command(command[0])
 	default:
-		cmd = exec.CommandContext(ctx, j.Command[0], j.Command[1:]...)
+		cmd = exec.Command(command[0], command[1:]...)
 	}
 
+	// run the job in its own process group so that on termination
+	// processes it spawned get terminated as well
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
 	// Add env vars
 	cmd.Env = os.Environ()
 	for k, v := range j.Env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
+	for k, v := range jr.Params {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
 
 	cmd.Dir = j.WorkingDirectory
 
-	var w io.Writer
-	switch j.cfg.SuppressLogs {
-	case true:
-		w = &jr.logBuf
-	default:
-		w = io.MultiWriter(os.Stdout, &jr.logBuf)
+	var echo io.Writer
+	if !suppressLogs {
+		echo = os.Stdout
 	}
 
-	// Merge stdout and stderr to same writer
-	cmd.Stdout = w
-	cmd.Stderr = w
+	// Capture stdout and stderr separately, messages
+	// of cheek itself go to a stream of their own
+	out := newOutputCapture(j, &jr, echo)
+	cmd.Stdout = out.stream(StreamStdout)
+	cmd.Stderr = out.stream(StreamStderr)
+	w := out.stream(StreamCheek)
 
 	// Start command execution
-	err := cmd.Start()
+	err = cmd.Start()
 	if err != nil {
 		// Existing logging logic
 		if !suppressLogs {
@@ -259,18 +460,49 @@ func (j *JobSpec) execCommandContext(ctx context.Context, jr JobRun, trigger str
 		}
 		jr.Log = logMessage   // Capture log message to jr.Log
 		jr.Status = &exitCode // Set the exit code in the job result
+		jr.lines = out.close()
 		return jr
 	}
 
+	// Terminate the job when it times out or the scheduler shuts down
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			j.terminate(cmd, killGrace, exited)
+		case <-exited:
+		}
+	}()
+
 	// Wait for the command to finish and check for errors
-	if err := cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	close(exited)
+
+	if errors.Is(context.Cause(ctx), errJobTimeout) {
+		exitCode := StatusTimeout
+		jr.Status = &exitCode
+		j.log.Warn().Str("job", j.Name).Str("trigger", trigger).Msgf("Job timed out after %v", timeout)
+		if _, writeErr := fmt.Fprintf(w, "\nJob timed out after %v\n", timeout); writeErr != nil {
+			j.log.Debug().Str("job", j.Name).Err(writeErr).Msg("can't write to log buffer")
+		}
+	} else if ctx.Err() != nil && cancelStatus(ctx) == StatusCancelled {
+		// the run counts as cancelled even if the job exited cleanly when asked to stop
+		exitCode := StatusCancelled
+		jr.Status = &exitCode
+		j.log.Info().Str("job", j.Name).Str("trigger", trigger).Msgf("Job killed due to %s", cancelReason(ctx))
+		if _, writeErr := fmt.Fprintf(w, "\nJob killed due to %s\n", cancelReason(ctx)); writeErr != nil {
+			j.log.Debug().Str("job", j.Name).Err(writeErr).Msg("can't write to log buffer")
+		}
+	} else if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			// Check if it was killed due to context cancellation
 			if ctx.Err() != nil {
-				jr.Log += "\nJob killed due to scheduler shutdown"
+				if _, writeErr := fmt.Fprintf(w, "\nJob killed due to %s\n", cancelReason(ctx)); writeErr != nil {
+					j.log.Debug().Str("job", j.Name).Err(writeErr).Msg("can't write to log buffer")
+				}
 				exitCode := StatusError
 				jr.Status = &exitCode
-				j.log.Info().Str("job", j.Name).Msg("Job killed due to context cancellation")
+				j.log.Info().Str("job", j.Name).Msgf("Job killed due to %s", cancelReason(ctx))
 			} else {
 				// Get the exact exit code from ExitError
 				exitCode := exitError.ExitCode()
@@ -283,6 +515,7 @@ func (j *JobSpec) execCommandContext(ctx context.Context, jr JobRun, trigger str
 			exitCode := StatusError
 			j.log.Error().Str("job", j.Name).Err(err).Msg("unexpected error during command execution")
 			jr.Status = &exitCode
+			jr.lines = out.close()
 			return jr
 		}
 	} else {
@@ -291,6 +524,7 @@ func (j *JobSpec) execCommandContext(ctx context.Context, jr JobRun, trigger str
 		jr.Status = &StatusCode // Command succeeded, set exit code 0
 	}
 
+	jr.lines = out.close()
 	jr.Duration = time.Duration(time.Since(jr.TriggeredAt).Milliseconds())
 
 	j.log.Debug().Str("job", j.Name).Int("exitcode", *jr.Status).Msgf("job exited with status: %d", *jr.Status)
@@ -298,30 +532,30 @@ func (j *JobSpec) execCommandContext(ctx context.Context, jr JobRun, trigger str
 	return jr
 }
 
-func (j *JobSpec) loadLogFromDb(id int) (JobRun, error) {
+func (j *JobSpec) loadRun(id int) (JobRun, error) {
 	var jr JobRun
-	if j.cfg.DB == nil {
-		j.log.Warn().Str("job", j.Name).Msg("No db connection, not loading job run from db.")
-		return jr, errors.New("no db connection")
+	if j.cfg.Store == nil {
+		j.log.Warn().Str("job", j.Name).Msg("No store configured, not loading job run.")
+		return jr, errors.New("no store configured")
 	}
 
-	jr, err := LoadJobRun(j.cfg.DB, j.Name, id)
+	jr, err := j.cfg.Store.JobRun(j.Name, id)
 	if err != nil {
-		j.log.Warn().Str("job", j.Name).Err(err).Msg("Couldn't load job run from db.")
+		j.log.Warn().Str("job", j.Name).Err(err).Msg("Couldn't load job run.")
 		return jr, err
 	}
 	return jr, nil
 }
 
-func (j *JobSpec) loadRunsFromDb(nruns int, includeLogs bool) {
-	if j.cfg.DB == nil {
-		j.log.Warn().Str("job", j.Name).Msg("No db connection, not loading job runs from db.")
+func (j *JobSpec) loadRuns(nruns int, includeLogs bool) {
+	if j.cfg.Store == nil {
+		j.log.Warn().Str("job", j.Name).Msg("No store configured, not loading job runs.")
 		return
 	}
 
-	jrs, err := LoadJobRuns(j.cfg.DB, j.Name, nruns, includeLogs)
+	jrs, err := j.cfg.Store.JobRuns(j.Name, nruns, includeLogs)
 	if err != nil {
-		j.log.Warn().Str("job", j.Name).Err(err).Msg("Couldn't load job runs from db.")
+		j.log.Warn().Str("job", j.Name).Err(err).Msg("Couldn't load job runs.")
 		return
 	}
 	j.Runs = jrs
@@ -329,13 +563,54 @@ func (j *JobSpec) loadRunsFromDb(nruns int, includeLogs bool) {
 
 func (j *JobSpec) setNextTick(refTime time.Time, includeRefTime bool) error {
 	if j.Cron != "" {
-		t, err := gronx.NextTickAfter(j.Cron, refTime, includeRefTime)
+		loc := refTime.Location()
+		if j.loc != nil {
+			loc = j.loc
+		}
+		t, err := nextTickIn(j.Cron, refTime, includeRefTime, loc)
 		j.nextTick = t
 		return err
 	}
 	return nil
 }
 
+// nextTickIn determines the next tick of a cron string in the given location.
+// The cron string is evaluated against wall clock time, which defines how DST
+// transitions are handled: wall clock times that are skipped run once at the
+// first instant after the gap and wall clock times that repeat run only once.
+func nextTickIn(cron string, refTime time.Time, includeRefTime bool, loc *time.Location) (time.Time, error) {
+	refTime = refTime.In(loc)
+	wall := wallClock(refTime)
+	for {
+		w, err := gronx.NextTickAfter(cron, wall, includeRefTime)
+		if err != nil {
+			return w, err
+		}
+
+		t := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, loc)
+		if !wallClock(t).Equal(w) {
+			// wall clock time falls in a DST gap,
+			// run at the start of the zone after the gap
+			t, _ = t.ZoneBounds()
+		}
+
+		// a repeated wall clock time can map onto an
+		// instant that has passed already, skip it
+		if t.After(refTime) || (includeRefTime && t.Equal(refTime)) {
+			return t, nil
+		}
+		wall, includeRefTime = w, false
+	}
+}
+
+// maxDSTShift is more than DST moves the wall clock in any time zone.
+const maxDSTShift = 3 * time.Hour
+
+// wallClock returns the wall clock time of t as if it were UTC, which has no DST.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
 func (j *JobSpec) ValidateCron() error {
 	if j.Cron != "" {
 		gronx := gronx.New()
@@ -346,22 +621,113 @@ func (j *JobSpec) ValidateCron() error {
 	return nil
 }
 
+func (j *JobSpec) ValidateMisfirePolicy() error {
+	switch j.MisfirePolicy {
+	case "", MisfireSkip:
+		return nil
+	case MisfireRunOnce, MisfireRunAll:
+		if j.Cron == "" {
+			return fmt.Errorf("misfire_policy for job '%s' requires a cron string", j.Name)
+		}
+		if j.MisfireMaxRuns < 0 || j.MisfireGrace < 0 {
+			return fmt.Errorf("misfire_max_runs and misfire_grace for job '%s' cannot be negative", j.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("misfire_policy '%s' for job '%s' not valid, should be one of %s, %s or %s", j.MisfirePolicy, j.Name, MisfireSkip, MisfireRunOnce, MisfireRunAll)
+	}
+}
+
+// missedTicks returns the cron ticks between the last scheduled run and now
+// that should be caught up on according to the job's misfire policy, oldest first.
+func (j *JobSpec) missedTicks(lastRun time.Time, now time.Time) ([]time.Time, error) {
+	if j.Cron == "" || lastRun.IsZero() {
+		return nil, nil
+	}
+
+	var maxRuns int
+	switch j.MisfirePolicy {
+	case MisfireRunOnce:
+		maxRuns = 1
+	case MisfireRunAll:
+		maxRuns = j.MisfireMaxRuns
+		if maxRuns == 0 {
+			maxRuns = defaultMisfireMaxRuns
+		}
+	default:
+		return nil, nil
+	}
+
+	// ticks older than the grace period are not caught up on
+	since := lastRun
+	if j.MisfireGrace > 0 && now.Add(-j.MisfireGrace).After(since) {
+		since = now.Add(-j.MisfireGrace)
+	}
+
+	loc := now.Location()
+	if j.loc != nil {
+		loc = j.loc
+	}
+
+	// only the most recent ticks are caught up on, walk back from now on
+	// the wall clock so older ticks don't have to be stepped through
+	wall := wallClock(now.In(loc))
+	for i := 0; i < maxRuns; i++ {
+		prev, err := gronx.PrevTickBefore(j.Cron, wall, false)
+		if err != nil {
+			return nil, err
+		}
+		wall = prev
+	}
+	// the wall clock is off by the DST shift around transitions
+	from := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc).Add(-maxDSTShift)
+	if from.Before(since) {
+		from = since
+	}
+
+	// step through the ticks the way the scheduler does, so skipped and
+	// repeated wall clock times are caught up on like they would have run
+	var ticks []time.Time
+	for {
+		next, err := nextTickIn(j.Cron, from, false, loc)
+		if err != nil {
+			return nil, err
+		}
+		if !next.Before(now) {
+			break
+		}
+		ticks = append(ticks, next)
+		from = next
+	}
+	if len(ticks) > maxRuns {
+		ticks = ticks[len(ticks)-maxRuns:]
+	}
+	return ticks, nil
+}
+
+// eventsForStatus selects the event specs that apply to a run's exit status,
+// timed out runs trigger both the on_error and on_timeout events and
+// cancelled runs none at all.
+func eventsForStatus(status int, onSuccess OnEvent, onError OnEvent, onTimeout OnEvent) []OnEvent {
+	switch status {
+	case StatusOK:
+		return []OnEvent{onSuccess}
+	case StatusTimeout:
+		return []OnEvent{onError, onTimeout}
+	case StatusCancelled:
+		return nil
+	default:
+		return []OnEvent{onError}
+	}
+}
+
 func (j *JobSpec) OnEvent(jr *JobRun) {
 	var jobsToTrigger []string
 	var webhooksToCall []webhook
-	var events []OnEvent
 
-	switch *jr.Status == StatusOK {
-	case true: // after success
-		events = append(events, j.OnSuccess)
-		if j.globalSchedule != nil {
-			events = append(events, j.globalSchedule.OnSuccess)
-		}
-	case false: // after error
-		events = append(events, j.OnError)
-		if j.globalSchedule != nil {
-			events = append(events, j.globalSchedule.OnError)
-		}
+	events := eventsForStatus(*jr.Status, j.OnSuccess, j.OnError, j.OnTimeout)
+	if j.globalSchedule != nil {
+		events = append(events, j.globalSchedule.events(*jr.Status)...)
 	}
 
 	for _, e := range events {
@@ -380,17 +746,18 @@ func (j *JobSpec) OnEvent(jr *JobRun) {
 	var wg sync.WaitGroup
 
 	for _, tn := range jobsToTrigger {
-		tj := j.globalSchedule.Jobs[tn]
+		tj, ok := j.globalSchedule.job(tn)
+		if !ok {
+			// can happen when the job got removed by a schedule reload
+			j.log.Warn().Str("job", j.Name).Str("on_event", "job_trigger").Msgf("cannot find job '%s' to trigger", tn)
+			continue
+		}
 		j.log.Debug().Str("job", j.Name).Str("on_event", "job_trigger").Msg("triggered by parent job")
 		wg.Add(1)
 		go func(wg *sync.WaitGroup, tj *JobSpec) {
 			defer wg.Done()
-			if tj.DisableConcurrentExecution {
-				tj.mutex.Lock()
-				defer tj.mutex.Unlock()
-			}
 			// Use background context for triggered jobs (they should complete independently)
-			tj.execCommandWithRetry(fmt.Sprintf("job[%s]", j.Name))
+			tj.run(context.Background(), fmt.Sprintf("job[%s]", j.Name))
 		}(&wg, tj)
 	}
 
@@ -401,6 +768,7 @@ func (j *JobSpec) OnEvent(jr *JobRun) {
 		go func(wg *sync.WaitGroup, wu webhook) {
 			defer wg.Done()
 			resp_body, err := wu.Call(jr)
+			j.metrics().delivered(j.Name, wu.Name(), err)
 			if err != nil {
 				j.log.Warn().Str("job", j.Name).Str("on_event", "webhook").Err(err).Msg("webhook notify failed")
 			}
@@ -423,8 +791,8 @@ func (j *JobSpec) ToYAML(includeRuns bool) (string, error) {
 	return string(yData), nil
 }
 
-// RunJob allows to run a specific job
-func RunJob(log zerolog.Logger, cfg Config, scheduleFn string, jobName string) (JobRun, error) {
+// RunJob allows to run a specific job, with the given param values
+func RunJob(log zerolog.Logger, cfg Config, scheduleFn string, jobName string, values map[string]string) (JobRun, error) {
 	s, err := loadSchedule(log, cfg, scheduleFn)
 	if err != nil {
 		log.Error().Err(err).Msgf("error loading schedule: %s", scheduleFn)
@@ -433,8 +801,13 @@ func RunJob(log zerolog.Logger, cfg Config, scheduleFn string, jobName string) (
 
 	for _, job := range s.Jobs {
 		if job.Name == jobName {
+			params, err := job.resolveParams(values)
+			if err != nil {
+				return JobRun{}, fmt.Errorf("cannot trigger job %s: %w", jobName, err)
+			}
+
 			// Use the setup function to create a JobRun instance
-			jr := job.setup("manual")
+			jr := job.setup("manual", params)
 
 			// Execute the command with the initialized JobRun and the trigger string
 			jr = job.execCommand(jr, "manual")
@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
 )
@@ -251,7 +255,7 @@ func TestStandaloneJobRun(t *testing.T) {
 	log := NewLogger("debug", nil, b, os.Stdout)
 	cfg := NewConfig()
 
-	jr, err := RunJob(log, cfg, "../testdata/jobs1.yaml", "bar")
+	jr, err := RunJob(log, cfg, "../testdata/jobs1.yaml", "bar", nil)
 	assert.NoError(t, err)
 	assert.Contains(t, b.String(), "\"job\":\"bar\",\"trigger\":\"manual\"")
 	assert.Contains(t, jr.Log, "bar_foo")
@@ -262,7 +266,7 @@ func TestWorkingDir(t *testing.T) {
 	log := NewLogger("debug", nil, b, os.Stdout)
 	cfg := NewConfig()
 
-	jr, err := RunJob(log, cfg, "../testdata/readme_example.yaml", "other_workingdir")
+	jr, err := RunJob(log, cfg, "../testdata/readme_example.yaml", "other_workingdir", nil)
 	assert.NoError(t, err)
 	assert.Contains(t, jr.Log, "/testdata")
 }
@@ -385,3 +389,381 @@ func TestMarshalSecret(t *testing.T) {
 	}
 	assert.Equal(t, string(jsonResult), `{"foo":"***"}`)
 }
+
+func TestMissedTicks(t *testing.T) {
+	now := time.Date(2024, 1, 10, 12, 0, 30, 0, time.UTC)
+	lastRun := time.Date(2024, 1, 5, 2, 0, 1, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		spec     *JobSpec
+		lastRun  time.Time
+		expected []time.Time
+	}{
+		{
+			name:    "skip",
+			spec:    &JobSpec{Cron: "0 2 * * *", MisfirePolicy: MisfireSkip},
+			lastRun: lastRun,
+		},
+		{
+			name:    "never ran",
+			spec:    &JobSpec{Cron: "0 2 * * *", MisfirePolicy: MisfireRunAll},
+			lastRun: time.Time{},
+		},
+		{
+			name:     "run_once",
+			spec:     &JobSpec{Cron: "0 2 * * *", MisfirePolicy: MisfireRunOnce},
+			lastRun:  lastRun,
+			expected: []time.Time{time.Date(2024, 1, 10, 2, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:    "run_all",
+			spec:    &JobSpec{Cron: "0 2 * * *", MisfirePolicy: MisfireRunAll},
+			lastRun: lastRun,
+			expected: []time.Time{
+				time.Date(2024, 1, 6, 2, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 7, 2, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 8, 2, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 9, 2, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 10, 2, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "run_all capped",
+			spec:    &JobSpec{Cron: "0 2 * * *", MisfirePolicy: MisfireRunAll, MisfireMaxRuns: 2},
+			lastRun: lastRun,
+			expected: []time.Time{
+				time.Date(2024, 1, 9, 2, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 10, 2, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:     "run_all with grace",
+			spec:     &JobSpec{Cron: "0 2 * * *", MisfirePolicy: MisfireRunAll, MisfireGrace: 24 * time.Hour},
+			lastRun:  lastRun,
+			expected: []time.Time{time.Date(2024, 1, 10, 2, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:    "run_once outside grace",
+			spec:    &JobSpec{Cron: "0 2 * * *", MisfirePolicy: MisfireRunOnce, MisfireGrace: time.Hour},
+			lastRun: lastRun,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ticks, err := tc.spec.missedTicks(tc.lastRun, now)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, ticks)
+		})
+	}
+}
+
+func TestMissedTicksDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Brussels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missed := func(cron string, lastRun, now time.Time) []time.Time {
+		t.Helper()
+		j := &JobSpec{Cron: cron, MisfirePolicy: MisfireRunAll, MisfireMaxRuns: 10, loc: loc}
+		ticks, err := j.missedTicks(lastRun, now)
+		assert.NoError(t, err)
+		return ticks
+	}
+
+	// 2024-03-31 02:00 CET jumps to 03:00 CEST, skipped times are caught up
+	// on once, at the first instant after the gap
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 3, 30, 2, 30, 0, 0, loc),
+		time.Date(2024, 3, 31, 3, 0, 0, 0, loc),
+		time.Date(2024, 4, 1, 2, 30, 0, 0, loc),
+	}, missed("30 2 * * *", time.Date(2024, 3, 29, 2, 30, 0, 0, loc), time.Date(2024, 4, 1, 12, 0, 0, 0, loc)))
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 3, 31, 3, 0, 0, 0, loc),
+		time.Date(2024, 3, 31, 3, 15, 0, 0, loc),
+		time.Date(2024, 3, 31, 3, 30, 0, 0, loc),
+	}, missed("*/15 * * * *", time.Date(2024, 3, 31, 1, 50, 0, 0, loc), time.Date(2024, 3, 31, 3, 40, 0, 0, loc)))
+
+	// 2024-10-27 03:00 CEST falls back to 02:00 CET, repeated times are
+	// caught up on once, like the scheduler runs them
+	ticks := missed("0 * * * *", time.Date(2024, 10, 27, 0, 0, 0, 0, loc), time.Date(2024, 10, 27, 5, 30, 0, 0, loc))
+	var hours []int
+	for _, tick := range ticks {
+		hours = append(hours, tick.Hour())
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, hours)
+
+	// the ticks match those the scheduler would have run
+	lastRun := time.Date(2024, 10, 26, 12, 0, 0, 0, loc)
+	now := time.Date(2024, 10, 28, 12, 0, 0, 0, loc)
+	var scheduled []time.Time
+	for ref := lastRun; ; {
+		ref, err = nextTickIn("0 */6 * * *", ref, false, loc)
+		assert.NoError(t, err)
+		if !ref.Before(now) {
+			break
+		}
+		scheduled = append(scheduled, ref)
+	}
+	assert.Equal(t, scheduled, missed("0 */6 * * *", lastRun, now))
+}
+
+func TestValidateMisfirePolicy(t *testing.T) {
+	assert.NoError(t, (&JobSpec{}).ValidateMisfirePolicy())
+	assert.NoError(t, (&JobSpec{Cron: "* * * * *", MisfirePolicy: MisfireRunAll}).ValidateMisfirePolicy())
+	assert.Error(t, (&JobSpec{MisfirePolicy: MisfireRunOnce}).ValidateMisfirePolicy())
+	assert.Error(t, (&JobSpec{Cron: "* * * * *", MisfirePolicy: "sometimes"}).ValidateMisfirePolicy())
+}
+
+func TestNextTickDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Brussels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2024-03-31 02:00 CET jumps to 03:00 CEST, skipped times run once after the gap
+	next, err := nextTickIn("30 2 * * *", time.Date(2024, 3, 31, 1, 0, 0, 0, loc), false, loc)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 31, 3, 0, 0, 0, loc), next)
+
+	next, err = nextTickIn("30 2 * * *", next, false, loc)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 4, 1, 2, 30, 0, 0, loc), next)
+
+	var ticks []time.Time
+	ref := time.Date(2024, 3, 31, 1, 50, 0, 0, loc)
+	for ref.Before(time.Date(2024, 3, 31, 3, 30, 0, 0, loc)) {
+		ref, err = nextTickIn("*/15 * * * *", ref, false, loc)
+		assert.NoError(t, err)
+		ticks = append(ticks, ref)
+	}
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 3, 31, 3, 0, 0, 0, loc),
+		time.Date(2024, 3, 31, 3, 15, 0, 0, loc),
+		time.Date(2024, 3, 31, 3, 30, 0, 0, loc),
+	}, ticks, "ticks in the gap should collapse into a single run")
+
+	// 2024-10-27 03:00 CEST falls back to 02:00 CET, repeated times run once
+	ticks = nil
+	ref = time.Date(2024, 10, 27, 0, 30, 0, 0, loc)
+	for ref.Before(time.Date(2024, 10, 27, 5, 0, 0, 0, loc)) {
+		ref, err = nextTickIn("0 * * * *", ref, false, loc)
+		assert.NoError(t, err)
+		ticks = append(ticks, ref)
+	}
+	assert.Len(t, ticks, 5, "repeated hour should only run once")
+	for i := 1; i < len(ticks); i++ {
+		assert.True(t, ticks[i].After(ticks[i-1]), "ticks should be increasing")
+		assert.Equal(t, (ticks[i-1].Hour()+1)%24, ticks[i].Hour())
+	}
+}
+
+func TestJobTZLocation(t *testing.T) {
+	s := Schedule{
+		Jobs: map[string]*JobSpec{
+			"brussels": {Cron: "0 9 * * *", Command: []string{"ls"}},
+			"new_york": {Cron: "0 9 * * *", Command: []string{"ls"}, TZLocation: "America/New_York"},
+		},
+		TZLocation: "Europe/Brussels",
+		log:        zerolog.Nop(),
+		cfg:        NewConfig(),
+	}
+	assert.NoError(t, s.initialize())
+
+	brussels := s.Jobs["brussels"].nextTick
+	newYork := s.Jobs["new_york"].nextTick
+	assert.Equal(t, "Europe/Brussels", brussels.Location().String())
+	assert.Equal(t, "America/New_York", newYork.Location().String())
+	assert.Equal(t, 9, brussels.Hour())
+	assert.Equal(t, 9, newYork.Hour())
+	assert.NotEqual(t, brussels.UTC().Hour(), newYork.UTC().Hour())
+
+	s.Jobs["new_york"].TZLocation = "Moon/Tranquility_Base"
+	assert.Error(t, s.initialize())
+}
+
+func TestJobTimeout(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	j := &JobSpec{
+		Name:    "test",
+		Command: []string{"sleep", "10"},
+		Timeout: 200 * time.Millisecond,
+		cfg:     cfg,
+	}
+
+	start := time.Now()
+	jr := j.execCommand(JobRun{TriggeredAt: start}, "test")
+	jr.flushLogBuffer()
+
+	assert.Equal(t, StatusTimeout, *jr.Status)
+	assert.Contains(t, jr.Log, "Job timed out after 200ms")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestJobTimeoutKillsProcessGroup(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	for name, command := range map[string][]string{
+		// the backgrounded sleep keeps the output pipe open
+		// unless the whole process group gets terminated
+		"process group": {"sh", "-c", "sleep 10 & wait"},
+		// ignoring SIGTERM requires a SIGKILL after the grace period
+		"ignores SIGTERM": {"sh", "-c", "trap '' TERM; sleep 10"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			j := &JobSpec{
+				Name:      "test",
+				Command:   command,
+				Timeout:   200 * time.Millisecond,
+				KillGrace: 200 * time.Millisecond,
+				cfg:       cfg,
+			}
+
+			start := time.Now()
+			jr := j.execCommand(JobRun{TriggeredAt: start}, "test")
+			assert.Equal(t, StatusTimeout, *jr.Status)
+			assert.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+}
+
+func TestJobTimeoutDefaults(t *testing.T) {
+	s := &Schedule{Timeout: time.Minute, KillGrace: time.Second}
+	j := &JobSpec{globalSchedule: s}
+
+	timeout, killGrace := j.timeouts()
+	assert.Equal(t, time.Minute, timeout)
+	assert.Equal(t, time.Second, killGrace)
+
+	j.Timeout = time.Hour
+	timeout, _ = j.timeouts()
+	assert.Equal(t, time.Hour, timeout)
+
+	timeout, killGrace = (&JobSpec{}).timeouts()
+	assert.Equal(t, time.Duration(0), timeout)
+	assert.Equal(t, defaultKillGrace, killGrace)
+}
+
+func TestEventsForStatus(t *testing.T) {
+	onSuccess := OnEvent{TriggerJob: []string{"success"}}
+	onError := OnEvent{TriggerJob: []string{"error"}}
+	onTimeout := OnEvent{TriggerJob: []string{"timeout"}}
+
+	assert.Equal(t, []OnEvent{onSuccess}, eventsForStatus(StatusOK, onSuccess, onError, onTimeout))
+	assert.Equal(t, []OnEvent{onError}, eventsForStatus(1, onSuccess, onError, onTimeout))
+	assert.Equal(t, []OnEvent{onError, onTimeout}, eventsForStatus(StatusTimeout, onSuccess, onError, onTimeout))
+}
+
+func TestRetryDelay(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		spec     *JobSpec
+		expected []time.Duration
+	}{
+		{
+			name:     "default",
+			spec:     &JobSpec{},
+			expected: []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+		{
+			name:     "fixed",
+			spec:     &JobSpec{RetryDelay: time.Second, RetryBackoff: BackoffFixed},
+			expected: []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name:     "exponential",
+			spec:     &JobSpec{RetryDelay: time.Second, RetryBackoff: BackoffExponential},
+			expected: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second},
+		},
+		{
+			name:     "exponential with max delay",
+			spec:     &JobSpec{RetryDelay: time.Second, RetryBackoff: BackoffExponential, RetryMaxDelay: 3 * time.Second},
+			expected: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:     "exponential capped at an hour by default",
+			spec:     &JobSpec{RetryDelay: 20 * time.Minute, RetryBackoff: BackoffExponential},
+			expected: []time.Duration{20 * time.Minute, 40 * time.Minute, time.Hour, time.Hour},
+		},
+		{
+			name:     "exponential from above the default cap",
+			spec:     &JobSpec{RetryDelay: 2 * time.Hour, RetryBackoff: BackoffExponential},
+			expected: []time.Duration{2 * time.Hour, 2 * time.Hour},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, expected := range tc.expected {
+				assert.Equal(t, expected, tc.spec.retryDelay(i+1))
+			}
+		})
+	}
+
+	// many retries don't overflow the delay
+	assert.Equal(t, time.Hour, (&JobSpec{RetryBackoff: BackoffExponential}).retryDelay(100))
+	assert.Equal(t, time.Duration(math.MaxInt64), (&JobSpec{RetryBackoff: BackoffExponential, RetryMaxDelay: math.MaxInt64}).retryDelay(100))
+
+	j := &JobSpec{RetryDelay: 10 * time.Second, RetryJitter: 0.5}
+	for i := 0; i < 100; i++ {
+		delay := j.retryDelay(1)
+		assert.GreaterOrEqual(t, delay, 5*time.Second)
+		assert.LessOrEqual(t, delay, 15*time.Second)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	assert.True(t, (&JobSpec{}).shouldRetry(1))
+	assert.True(t, (&JobSpec{RetryOnExitCodes: []int{1, 3}}).shouldRetry(3))
+	assert.False(t, (&JobSpec{RetryOnExitCodes: []int{1, 3}}).shouldRetry(2))
+	assert.False(t, (&JobSpec{NoRetryOnExitCodes: []int{2}}).shouldRetry(2))
+	assert.True(t, (&JobSpec{NoRetryOnExitCodes: []int{2}}).shouldRetry(StatusTimeout))
+}
+
+func TestValidateRetries(t *testing.T) {
+	assert.NoError(t, (&JobSpec{Retries: 3, RetryBackoff: BackoffExponential, RetryJitter: 0.2}).ValidateRetries())
+	assert.Error(t, (&JobSpec{RetryBackoff: "linear"}).ValidateRetries())
+	assert.Error(t, (&JobSpec{RetryJitter: 2}).ValidateRetries())
+	assert.Error(t, (&JobSpec{RetryOnExitCodes: []int{1}, NoRetryOnExitCodes: []int{2}}).ValidateRetries())
+
+}
+
+func TestRetryOnExitCodes(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	// every attempt leaves a line in the attempts file
+	attempts := func(fn string) int {
+		b, err := os.ReadFile(fn)
+		assert.NoError(t, err)
+		return strings.Count(string(b), "\n")
+	}
+
+	// deterministic failures should fail fast
+	fn := filepath.Join(t.TempDir(), "attempts")
+	j := &JobSpec{
+		Name:               "test",
+		Command:            []string{"sh", "-c", "echo attempt >> " + fn + "; exit 2"},
+		Retries:            3,
+		RetryDelay:         10 * time.Millisecond,
+		NoRetryOnExitCodes: []int{2},
+		cfg:                cfg,
+	}
+	jr := j.execCommandWithRetry("test")
+	assert.Equal(t, 2, *jr.Status)
+	assert.Equal(t, 1, attempts(fn))
+
+	// others should be retried
+	fn = filepath.Join(t.TempDir(), "attempts")
+	j = &JobSpec{
+		Name:             "test",
+		Command:          []string{"sh", "-c", "echo attempt >> " + fn + "; exit 1"},
+		Retries:          2,
+		RetryDelay:       10 * time.Millisecond,
+		RetryOnExitCodes: []int{1},
+		cfg:              cfg,
+	}
+	jr = j.execCommandWithRetry("test")
+	assert.Equal(t, 1, *jr.Status)
+	assert.Equal(t, 3, attempts(fn))
+}
@@ -0,0 +1,378 @@
+package cheek
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps everything in memory, nothing survives a restart.
+// It's meant for ephemeral setups such as CI containers.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	nextID   int
+	runs     []JobRun
+	lines    map[int][]LogLine
+	coreLogs []CoreLogEntry
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{lines: map[int][]LogLine{}}
+}
+
+// stored returns a copy of a job run with only the fields that are persisted.
+func stored(jr *JobRun) JobRun {
+	c := JobRun{
+		LogEntryId:  jr.LogEntryId,
+		Queued:      jr.Queued,
+		Log:         jr.Log,
+		Name:        jr.Name,
+		TriggeredAt: jr.TriggeredAt,
+		TriggeredBy: jr.TriggeredBy,
+		Duration:    jr.Duration,
+		Params:      maps.Clone(jr.Params),
+	}
+	if jr.Status != nil {
+		status := *jr.Status
+		c.Status = &status
+	}
+	return c
+}
+
+// index returns the position of a job run, or -1 if it isn't stored. Like
+// in the sqlite store runs are identified by job, trigger time and trigger.
+func (s *MemoryStore) index(jr *JobRun) int {
+	for i, r := range s.runs {
+		if r.Name == jr.Name && r.TriggeredBy == jr.TriggeredBy && r.TriggeredAt.Equal(jr.TriggeredAt) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *MemoryStore) insert(jr JobRun) int {
+	s.nextID++
+	jr.LogEntryId = s.nextID
+	s.runs = append(s.runs, jr)
+	return jr.LogEntryId
+}
+
+func (s *MemoryStore) SaveJobRun(jr *JobRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.index(jr); i >= 0 {
+		jr.LogEntryId = s.runs[i].LogEntryId
+		s.runs[i] = stored(jr)
+		return nil
+	}
+	jr.LogEntryId = s.insert(stored(jr))
+	return nil
+}
+
+func (s *MemoryStore) AppendLogLines(lines []LogLine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range lines {
+		s.nextID++
+		l.ID = s.nextID
+		s.lines[l.JobRunID] = append(s.lines[l.JobRunID], l)
+	}
+	return nil
+}
+
+func (s *MemoryStore) LogLines(jobRunID int, afterLineNumber int) ([]LogLine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var lines []LogLine
+	for _, l := range s.lines[jobRunID] {
+		if l.LineNumber > afterLineNumber {
+			lines = append(lines, l)
+		}
+	}
+	sort.SliceStable(lines, func(a, b int) bool { return lines[a].LineNumber < lines[b].LineNumber })
+	return lines, nil
+}
+
+// latestRuns returns the runs of a job, newest first.
+func (s *MemoryStore) latestRuns(jobName string) []JobRun {
+	var jrs []JobRun
+	for _, r := range s.runs {
+		if r.Name == jobName {
+			jrs = append(jrs, r)
+		}
+	}
+	sort.SliceStable(jrs, func(a, b int) bool {
+		if !jrs[a].TriggeredAt.Equal(jrs[b].TriggeredAt) {
+			return jrs[a].TriggeredAt.After(jrs[b].TriggeredAt)
+		}
+		return jrs[a].LogEntryId > jrs[b].LogEntryId
+	})
+	return jrs
+}
+
+func (s *MemoryStore) JobRun(jobName string, id int) (JobRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if id == -1 {
+		if jrs := s.latestRuns(jobName); len(jrs) > 0 {
+			return jrs[0], nil
+		}
+		return JobRun{}, ErrJobRunNotFound
+	}
+	for _, r := range s.runs {
+		if r.LogEntryId == id {
+			return r, nil
+		}
+	}
+	return JobRun{}, ErrJobRunNotFound
+}
+
+func (s *MemoryStore) JobRuns(jobName string, nruns int, includeLogs bool) ([]JobRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jrs := s.latestRuns(jobName)
+	if len(jrs) > nruns {
+		jrs = jrs[:nruns]
+	}
+	if !includeLogs {
+		for i := range jrs {
+			jrs[i].Log = ""
+		}
+	}
+	return jrs, nil
+}
+
+func (s *MemoryStore) LastScheduledRun(jobName string) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.latestRuns(jobName) {
+		if r.TriggeredBy == "cron" || r.TriggeredBy == triggerCatchup {
+			return r.TriggeredAt, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryStore) IsJobRunActive(jobName string, id int) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.runs {
+		if r.Name == jobName && r.LogEntryId == id {
+			return r.Queued || r.Status == nil, nil
+		}
+	}
+	return false, ErrJobRunNotFound
+}
+
+func (s *MemoryStore) Runs(q RunQuery) (RunPage, error) {
+	if err := q.validate(); err != nil {
+		return RunPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var jrs []JobRun
+	for _, r := range s.runs {
+		if q.matches(r) {
+			r.Log = ""
+			jrs = append(jrs, r)
+		}
+	}
+	q.sortRuns(jrs)
+	return q.page(jrs), nil
+}
+
+func (s *MemoryStore) JobNames() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[string]bool{}
+	var jobs []string
+	for _, r := range s.runs {
+		if !seen[r.Name] {
+			seen[r.Name] = true
+			jobs = append(jobs, r.Name)
+		}
+	}
+	sort.Strings(jobs)
+	return jobs, nil
+}
+
+func (s *MemoryStore) Stats(jobName string, since time.Time) (RunStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var all, jrs []JobRun
+	for _, r := range s.runs {
+		if (jobName != "" && r.Name != jobName) || r.Status == nil {
+			continue
+		}
+		all = append(all, r)
+		if !r.TriggeredAt.Before(since) {
+			jrs = append(jrs, r)
+		}
+	}
+	RunQuery{Sort: SortTriggeredAt}.sortRuns(all)
+	RunQuery{Sort: SortTriggeredAt}.sortRuns(jrs)
+	st := summarize(jrs)
+	st.setHistory(jobName, summarize(all))
+	return st, nil
+}
+
+func (s *MemoryStore) Search(q SearchQuery) ([]SearchResult, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jrs := make([]JobRun, len(s.runs))
+	copy(jrs, s.runs)
+	sort.SliceStable(jrs, func(a, b int) bool { return jrs[a].TriggeredAt.After(jrs[b].TriggeredAt) })
+
+	results := []SearchResult{}
+	for _, r := range jrs {
+		if len(results) >= q.limit() {
+			break
+		}
+		if (q.Job != "" && r.Name != q.Job) || (!q.Since.IsZero() && r.TriggeredAt.Before(q.Since)) || (!q.Until.IsZero() && r.TriggeredAt.After(q.Until)) {
+			continue
+		}
+		output := r.Log
+		if !r.Queued && r.Status == nil {
+			// runs that are executing only have their lines so far
+			output = s.output(r.LogEntryId)
+		}
+		snippet, ok := matchSnippet(output, q.terms())
+		if !ok {
+			continue
+		}
+		results = append(results, SearchResult{
+			ID:          r.LogEntryId,
+			Job:         r.Name,
+			TriggeredAt: r.TriggeredAt,
+			TriggeredBy: r.TriggeredBy,
+			Status:      r.Status,
+			Snippet:     highlight(snippet),
+		})
+	}
+	return results, nil
+}
+
+// output joins the lines of a run, the lock has to be held.
+func (s *MemoryStore) output(jobRunID int) string {
+	lines := slices.Clone(s.lines[jobRunID])
+	sort.SliceStable(lines, func(a, b int) bool { return lines[a].LineNumber < lines[b].LineNumber })
+	contents := make([]string, len(lines))
+	for i, l := range lines {
+		contents[i] = l.Content
+	}
+	return strings.Join(contents, "\n")
+}
+
+// prune deletes the runs of a job beyond keep runs or from before the
+// cutoff, together with their log lines. Active runs are never deleted.
+func (s *MemoryStore) prune(jobName string, keep int, before time.Time) int64 {
+	if keep == 0 && before.IsZero() {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	drop := map[int]bool{}
+	for i, r := range s.latestRuns(jobName) {
+		if r.Queued || r.Status == nil {
+			continue
+		}
+		if (keep > 0 && i >= keep) || r.TriggeredAt.Before(before) {
+			drop[r.LogEntryId] = true
+		}
+	}
+	if len(drop) == 0 {
+		return 0
+	}
+
+	runs := s.runs[:0]
+	for _, r := range s.runs {
+		if drop[r.LogEntryId] {
+			delete(s.lines, r.LogEntryId)
+			continue
+		}
+		runs = append(runs, r)
+	}
+	s.runs = runs
+	return int64(len(drop))
+}
+
+func (s *MemoryStore) PruneJobRuns(jobName string, r Retention, now time.Time) (int64, error) {
+	return s.prune(jobName, r.KeepRuns, cutoff(r.KeepDays, now)), nil
+}
+
+func (s *MemoryStore) WriteCoreLog(e CoreLogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	e.ID = s.nextID
+	s.coreLogs = append(s.coreLogs, e)
+	return nil
+}
+
+func (s *MemoryStore) CoreLogs(q CoreLogQuery) ([]CoreLogEntry, error) {
+	levels, err := q.levels()
+	if err != nil {
+		return nil, fmt.Errorf("level: %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	logs := []CoreLogEntry{}
+	for i := len(s.coreLogs) - 1; i >= 0 && len(logs) < q.limit(); i-- {
+		if e := s.coreLogs[i]; q.matches(e, levels) {
+			logs = append(logs, e)
+		}
+	}
+	return logs, nil
+}
+
+func (s *MemoryStore) PruneCoreLogs(r CoreLogRetention, now time.Time) (int64, error) {
+	before := cutoff(r.KeepDays, now)
+	if r.KeepLines == 0 && before.IsZero() {
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// core logs are kept in the order they were written
+	keep := s.coreLogs[:0]
+	for i, e := range s.coreLogs {
+		if (r.KeepLines > 0 && len(s.coreLogs)-i > r.KeepLines) || e.Time.Before(before) {
+			continue
+		}
+		keep = append(keep, e)
+	}
+	n := len(s.coreLogs) - len(keep)
+	s.coreLogs = keep
+	return int64(n), nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,221 @@
+package cheek
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// runDurationBuckets are the buckets of the run duration histogram in
+// seconds, jobs tend to take anything from a blink to a couple of hours.
+var runDurationBuckets = []float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200}
+
+// metrics are the prometheus metrics of a schedule, served on /metrics.
+type metrics struct {
+	registry    *prometheus.Registry
+	runs        *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	running     *prometheus.GaugeVec
+	queued      *prometheus.GaugeVec
+	retries     *prometheus.CounterVec
+	webhooks    *prometheus.CounterVec
+	lastSuccess *prometheus.GaugeVec
+	lastTick    prometheus.Gauge
+
+	s *Schedule
+	// nextRuns holds the next cron tick of the jobs as seen by the
+	// scheduler loop, which is the only one to touch the ticks
+	mu       sync.Mutex
+	nextRuns map[string]time.Time
+	nextRun  *prometheus.Desc
+}
+
+func newMetrics(s *Schedule) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cheek_job_runs_total",
+			Help: "Number of finished runs by job, status and trigger.",
+		}, []string{"job", "status", "trigger"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "cheek_job_run_duration_seconds",
+			Help:    "Duration of the runs that executed, by job.",
+			Buckets: runDurationBuckets,
+		}, []string{"job"}),
+		running: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cheek_job_running",
+			Help: "Number of runs that are executing, by job.",
+		}, []string{"job"}),
+		queued: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cheek_job_queued",
+			Help: "Number of runs that wait for a free worker or a slot in a concurrency group, by job.",
+		}, []string{"job"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cheek_job_retries_total",
+			Help: "Number of retries of failed runs, by job.",
+		}, []string{"job"}),
+		webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cheek_webhook_deliveries_total",
+			Help: "Number of webhook calls by job, webhook type and result.",
+		}, []string{"job", "webhook", "result"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cheek_job_last_success_timestamp_seconds",
+			Help: "Unix time at which the last successful run of a job was triggered.",
+		}, []string{"job"}),
+		lastTick: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "cheek_scheduler_last_tick_timestamp_seconds",
+			Help: "Unix time of the last tick of the scheduler loop.",
+		}),
+		s:        s,
+		nextRuns: map[string]time.Time{},
+		nextRun: prometheus.NewDesc("cheek_job_next_run_seconds",
+			"Seconds until the next scheduled run of a job.", []string{"job"}, nil),
+	}
+
+	m.registry.MustRegister(
+		m.runs, m.duration, m.running, m.queued, m.retries, m.webhooks, m.lastSuccess, m.lastTick, m,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// handler serves the metrics in the prometheus text format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Describe and Collect make the seconds until the next run a metric of
+// its own, computed when scraped.
+func (m *metrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.nextRun
+}
+
+func (m *metrics) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	jobs := m.s.jobs()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, next := range m.nextRuns {
+		// jobs can be gone after a reload
+		if _, ok := jobs[name]; !ok || next.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(m.nextRun, prometheus.GaugeValue, next.Sub(now).Seconds(), name)
+	}
+}
+
+// ticked records a tick of the scheduler loop and the next tick of a job.
+func (m *metrics) ticked(at time.Time, jobs map[string]*JobSpec) {
+	if m == nil {
+		return
+	}
+	m.lastTick.Set(float64(at.UnixNano()) / 1e9)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, j := range jobs {
+		if j.Cron != "" {
+			m.nextRuns[name] = j.nextTick
+		}
+	}
+}
+
+// runStatus names the status of a finished run.
+func runStatus(status int) string {
+	switch status {
+	case StatusOK:
+		return RunSucceeded
+	case StatusTimeout:
+		return RunTimedOut
+	case StatusSkipped:
+		return RunSkipped
+	case StatusCancelled:
+		return RunCancelled
+	default:
+		return RunFailed
+	}
+}
+
+// finished records a run that is done, after its retries if it had any.
+func (m *metrics) finished(jr JobRun) {
+	if m == nil || jr.Status == nil {
+		return
+	}
+	status := runStatus(*jr.Status)
+	m.runs.WithLabelValues(jr.Name, status, jr.TriggeredBy).Inc()
+	if status == RunSkipped || status == RunCancelled {
+		return
+	}
+	// durations of runs are stored in milliseconds
+	m.duration.WithLabelValues(jr.Name).Observe(float64(jr.Duration) / 1000)
+	if status == RunSucceeded {
+		m.succeeded(jr.Name, jr.TriggeredAt)
+	}
+}
+
+func (m *metrics) succeeded(job string, at time.Time) {
+	m.lastSuccess.WithLabelValues(job).Set(float64(at.UnixNano()) / 1e9)
+}
+
+func (m *metrics) addRunning(job string, delta float64) {
+	if m == nil {
+		return
+	}
+	m.running.WithLabelValues(job).Add(delta)
+}
+
+func (m *metrics) addQueued(job string, delta float64) {
+	if m == nil {
+		return
+	}
+	m.queued.WithLabelValues(job).Add(delta)
+}
+
+func (m *metrics) retried(job string) {
+	if m == nil {
+		return
+	}
+	m.retries.WithLabelValues(job).Inc()
+}
+
+func (m *metrics) delivered(job string, webhook string, err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.webhooks.WithLabelValues(job, webhook, result).Inc()
+}
+
+// loadLastSuccess picks up when the jobs last succeeded before cheek started.
+func (m *metrics) loadLastSuccess() {
+	if m == nil || m.s.cfg.Store == nil {
+		return
+	}
+	for name := range m.s.jobs() {
+		page, err := m.s.cfg.Store.Runs(RunQuery{Job: name, Status: []string{RunSucceeded}, Limit: 1})
+		if err != nil {
+			m.s.log.Warn().Str("job", name).Err(err).Msg("Couldn't load last successful run.")
+			continue
+		}
+		if len(page.Runs) > 0 {
+			m.succeeded(name, page.Runs[0].TriggeredAt)
+		}
+	}
+}
+
+// metrics returns the metrics of the schedule the job belongs to, if any.
+func (j *JobSpec) metrics() *metrics {
+	if j.globalSchedule == nil {
+		return nil
+	}
+	return j.globalSchedule.metrics
+}
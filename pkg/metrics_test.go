@@ -0,0 +1,83 @@
+package cheek
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hook.Close()
+
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, fmt.Sprintf(`
+jobs:
+  ok:
+    command: "true"
+    cron: "* * * * *"
+  flaky:
+    command: "false"
+    retries: 1
+    retry_delay: 10ms
+    on_error:
+      notify_webhook: [%s, http://127.0.0.1:1]
+`, hook.URL))
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	s, err := loadSchedule(NewLogger("debug", nil, new(tsBuffer)), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Jobs["ok"].run(context.Background(), "cron")
+	s.Jobs["flaky"].run(context.Background(), "ui")
+	s.metrics.ticked(s.now(), s.Jobs)
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	setupRouter(s).ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	body := resp.Body.String()
+	for _, want := range []string{
+		`cheek_job_runs_total{job="ok",status="success",trigger="cron"} 1`,
+		`cheek_job_runs_total{job="flaky",status="failed",trigger="ui"} 1`,
+		`cheek_job_run_duration_seconds_count{job="ok"} 1`,
+		`cheek_job_retries_total{job="flaky"} 1`,
+		`cheek_job_running{job="ok"} 0`,
+		`cheek_webhook_deliveries_total{job="flaky",result="success",webhook="generic"} 2`,
+		`cheek_webhook_deliveries_total{job="flaky",result="failure",webhook="generic"} 2`,
+		`cheek_job_last_success_timestamp_seconds{job="ok"}`,
+		`cheek_job_next_run_seconds{job="ok"}`,
+		`cheek_scheduler_last_tick_timestamp_seconds`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, body, want)
+	}
+	assert.NotContains(t, body, `cheek_job_next_run_seconds{job="flaky"}`)
+}
+
+func TestMetricsLastSuccess(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	s := &Schedule{Jobs: map[string]*JobSpec{"backup": {Name: "backup"}}, cfg: cfg}
+	s.metrics = newMetrics(s)
+
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	ok := StatusOK
+	assert.NoError(t, cfg.Store.SaveJobRun(&JobRun{Name: "backup", TriggeredAt: at, TriggeredBy: "cron", Status: &ok}))
+	s.metrics.loadLastSuccess()
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	setupRouter(s).ServeHTTP(resp, req)
+	assert.Contains(t, resp.Body.String(), `cheek_job_last_success_timestamp_seconds{job="backup"} 1.7145216e+09`)
+}
@@ -0,0 +1,280 @@
+package cheek
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the db has been migrated by a newer
+// version of cheek than the one that is running.
+var ErrSchemaTooNew = errors.New("db schema is newer than this version of cheek supports, upgrade cheek")
+
+// Migration is a change to the db schema, migrations are embedded as
+// migrations/{version}_{name}.sql and applied in order of their version.
+type Migration struct {
+	Version int    `json:"version" db:"version"`
+	Name    string `json:"name" db:"name"`
+	sql     string
+}
+
+// MigrationStatus tells whether and when a migration has been applied.
+// Migrations of dbs that predate schema_migrations have no AppliedAt.
+type MigrationStatus struct {
+	Migration
+	Applied   bool       `json:"applied" db:"-"`
+	AppliedAt *time.Time `json:"applied_at,omitempty" db:"applied_at"`
+}
+
+// Migrations returns the embedded migrations, ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	var ms []Migration
+	for _, e := range entries {
+		version, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		v, err := strconv.Atoi(version)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration '%s' should be named {version}_{name}.sql", e.Name())
+		}
+		sql, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration '%s': %w", e.Name(), err)
+		}
+		ms = append(ms, Migration{Version: v, Name: name, sql: string(sql)})
+	}
+
+	sort.Slice(ms, func(i, k int) bool { return ms[i].Version < ms[k].Version })
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions should be sequential, expected %d but got %d", i+1, m.Version)
+		}
+	}
+	return ms, nil
+}
+
+// hasMigrationsTable tells whether the schema_migrations table exists.
+func hasMigrationsTable(tx *sqlx.Tx) (bool, error) {
+	var n int
+	if err := tx.Get(&n, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"); err != nil {
+		return false, fmt.Errorf("inspect schema_migrations table: %w", err)
+	}
+	return n > 0, nil
+}
+
+// legacyVersion determines up to which migration the schema of a db that
+// predates schema_migrations corresponds, based on the latest change that
+// it has.
+func legacyVersion(tx *sqlx.Tx) (int, error) {
+	hasTable := func(name string) (bool, error) {
+		var n int
+		err := tx.Get(&n, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name)
+		return n > 0, err
+	}
+	hasColumn := func(table, column string) (bool, error) {
+		var n int
+		err := tx.Get(&n, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column)
+		return n > 0, err
+	}
+
+	checks := []func() (bool, error){
+		func() (bool, error) { return hasColumn("log", "is_queued") },
+		func() (bool, error) { return hasTable("log_lines") },
+		func() (bool, error) { return hasColumn("log", "is_running") },
+		func() (bool, error) { return hasTable("log") },
+	}
+	for i, check := range checks {
+		ok, err := check()
+		if err != nil {
+			return 0, fmt.Errorf("inspect legacy schema: %w", err)
+		}
+		if ok {
+			return len(checks) - i, nil
+		}
+	}
+	return 0, nil
+}
+
+// ensureMigrationsTable creates the schema_migrations table. Dbs created
+// before migrations existed get the migrations that match their schema
+// recorded as applied.
+func ensureMigrationsTable(db *sqlx.DB, ms []Migration) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("create schema_migrations table: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	exists, err := hasMigrationsTable(tx)
+	if err != nil || exists {
+		return err
+	}
+
+	version, err := legacyVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE TABLE schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations table: %w", err)
+	}
+
+	if version > 0 {
+		// remove old, non-conforming records
+		_, err = tx.Exec(`
+			DELETE FROM log
+			WHERE id NOT IN (
+				SELECT MIN(id)
+				FROM log
+				GROUP BY job, triggered_at, triggered_by
+			);
+		`)
+		if err != nil {
+			return fmt.Errorf("cleanup old log records: %w", err)
+		}
+	}
+	for _, m := range ms[:min(version, len(ms))] {
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			return fmt.Errorf("record legacy migration %d: %w", m.Version, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SchemaVersion returns the version of the latest migration applied to the db.
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	var version int
+	if err := db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations"); err != nil {
+		return 0, fmt.Errorf("get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrationsStatus lists the embedded migrations and when they were applied.
+// It doesn't change the db: for dbs that predate schema_migrations the
+// applied migrations are derived from their schema.
+func MigrationsStatus(db *sqlx.DB) ([]MigrationStatus, error) {
+	ms, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, 0, len(ms))
+	for _, m := range ms {
+		status = append(status, MigrationStatus{Migration: m})
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("load applied migrations: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	exists, err := hasMigrationsTable(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		version, err := legacyVersion(tx)
+		if err != nil {
+			return nil, err
+		}
+		for i := range status[:min(version, len(status))] {
+			status[i].Applied = true
+		}
+		return status, nil
+	}
+
+	var applied []MigrationStatus
+	if err := tx.Select(&applied, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version"); err != nil {
+		return nil, fmt.Errorf("load applied migrations: %w", err)
+	}
+	for _, a := range applied {
+		a.Applied = true
+		if a.Version > len(status) {
+			// applied by a newer version of cheek
+			status = append(status, a)
+			continue
+		}
+		status[a.Version-1].Applied = true
+		status[a.Version-1].AppliedAt = a.AppliedAt
+	}
+	return status, nil
+}
+
+// MigrateDB applies the pending migrations up to and including version to,
+// or all of them if to is 0. Each migration is applied in a transaction of
+// its own. Migrating down is not supported.
+func MigrateDB(db *sqlx.DB, to int) error {
+	ms, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if err := ensureMigrationsTable(db, ms); err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > len(ms) {
+		return fmt.Errorf("%w (db at version %d, cheek supports up to %d)", ErrSchemaTooNew, current, len(ms))
+	}
+
+	if to == 0 {
+		to = len(ms)
+	}
+	if to < 0 || to > len(ms) {
+		return fmt.Errorf("unknown migration version %d, latest is %d", to, len(ms))
+	}
+	if to < current {
+		return fmt.Errorf("cannot migrate down from version %d to %d", current, to)
+	}
+
+	for _, m := range ms[current:to] {
+		if err := applyMigration(db, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sqlx.DB, m Migration) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return fmt.Errorf("apply migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		return fmt.Errorf("apply migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		return fmt.Errorf("record migration %d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("apply migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
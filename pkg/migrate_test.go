@@ -0,0 +1,148 @@
+package cheek
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	// the in-memory db only lives on a single connection
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestMigrations(t *testing.T) {
+	ms, err := Migrations()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ms)
+	for i, m := range ms {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Name)
+	}
+}
+
+func TestMigrateDB(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	ms, err := Migrations()
+	assert.NoError(t, err)
+
+	// migrate up to a given version
+	assert.NoError(t, MigrateDB(db, 2))
+	version, err := SchemaVersion(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	status, err := MigrationsStatus(db)
+	assert.NoError(t, err)
+	assert.Len(t, status, len(ms))
+	assert.True(t, status[1].Applied)
+	assert.NotNil(t, status[1].AppliedAt)
+	assert.False(t, status[2].Applied)
+	assert.Nil(t, status[2].AppliedAt)
+
+	// migrating down is not supported
+	assert.Error(t, MigrateDB(db, 1))
+	assert.Error(t, MigrateDB(db, len(ms)+1))
+
+	// migrate the rest, which is a no-op when done twice
+	assert.NoError(t, MigrateDB(db, 0))
+	assert.NoError(t, MigrateDB(db, 0))
+	version, err = SchemaVersion(db)
+	assert.NoError(t, err)
+	assert.Equal(t, len(ms), version)
+}
+
+func TestMigrateDBTooNew(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	assert.NoError(t, InitDB(db))
+	_, err := db.Exec("INSERT INTO schema_migrations (version, name) VALUES (9999, 'from_the_future')")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, InitDB(db), ErrSchemaTooNew)
+
+	status, err := MigrationsStatus(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 9999, status[len(status)-1].Version)
+}
+
+// createLegacyLog creates the log table as it was before migrations and
+// log_lines existed.
+func createLegacyLog(t *testing.T, db *sqlx.DB) {
+	t.Helper()
+	_, err := db.Exec(`CREATE TABLE log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job TEXT,
+		triggered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		triggered_by TEXT,
+		duration INTEGER,
+		status INTEGER,
+		message TEXT,
+		is_running INTEGER DEFAULT 0,
+		UNIQUE(job, triggered_at, triggered_by)
+	)`)
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO log (job, triggered_at, triggered_by, status, message) VALUES ('job1', '2023-10-01 10:00:00', 'cron', 0, 'ok')")
+	assert.NoError(t, err)
+}
+
+func TestMigrationsStatusReadOnly(t *testing.T) {
+	tracked := func(db *sqlx.DB) bool {
+		var n int
+		assert.NoError(t, db.Get(&n, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'"))
+		return n > 0
+	}
+
+	// a new db stays empty
+	db := openTestDB(t)
+	defer db.Close()
+	status, err := MigrationsStatus(db)
+	assert.NoError(t, err)
+	for _, m := range status {
+		assert.False(t, m.Applied, "migration %d should be pending", m.Version)
+	}
+	assert.False(t, tracked(db))
+
+	// a legacy db isn't converted, the state is derived from its schema
+	legacy := openTestDB(t)
+	defer legacy.Close()
+	createLegacyLog(t, legacy)
+	status, err = MigrationsStatus(legacy)
+	assert.NoError(t, err)
+	for _, m := range status {
+		assert.Equal(t, m.Version <= 2, m.Applied, "migration %d", m.Version)
+		assert.Nil(t, m.AppliedAt)
+	}
+	assert.False(t, tracked(legacy))
+}
+
+func TestMigrateLegacyDB(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	createLegacyLog(t, db)
+
+	assert.NoError(t, InitDB(db))
+
+	status, err := MigrationsStatus(db)
+	assert.NoError(t, err)
+	for _, m := range status {
+		assert.True(t, m.Applied, "migration %d should be applied", m.Version)
+		assert.NotNil(t, m.AppliedAt, "migration %d should be applied", m.Version)
+	}
+
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM log WHERE is_queued = 0"))
+	assert.Equal(t, 1, count)
+	assert.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM log_lines"))
+	assert.Equal(t, 0, count)
+}
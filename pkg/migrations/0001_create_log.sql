@@ -0,0 +1,10 @@
+CREATE TABLE log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job TEXT,
+    triggered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    triggered_by TEXT,
+    duration INTEGER,
+    status INTEGER,
+    message TEXT,
+    UNIQUE(job, triggered_at, triggered_by)
+);
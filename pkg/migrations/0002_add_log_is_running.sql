@@ -0,0 +1 @@
+ALTER TABLE log ADD COLUMN is_running INTEGER DEFAULT 0;
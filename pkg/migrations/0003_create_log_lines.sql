@@ -0,0 +1,12 @@
+CREATE TABLE log_lines (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_run_id INTEGER NOT NULL,
+    line_number INTEGER NOT NULL,
+    timestamp TEXT NOT NULL,
+    content TEXT NOT NULL,
+    stream TEXT NOT NULL,
+    FOREIGN KEY (job_run_id) REFERENCES log(id),
+    UNIQUE(job_run_id, line_number)
+);
+
+CREATE INDEX idx_log_lines_job_run_id ON log_lines(job_run_id);
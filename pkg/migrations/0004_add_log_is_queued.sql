@@ -0,0 +1 @@
+ALTER TABLE log ADD COLUMN is_queued INTEGER DEFAULT 0;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS core_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    time DATETIME DEFAULT CURRENT_TIMESTAMP,
+    level TEXT NOT NULL DEFAULT '',
+    job TEXT,
+    message TEXT NOT NULL DEFAULT '',
+    fields TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_core_log_time ON core_log(time);
+
+-- core logs used to be stored as raw json in the log table
+INSERT INTO core_log (time, level, job, message, fields)
+SELECT
+    COALESCE(json_extract(message, '$.time'), triggered_at),
+    COALESCE(json_extract(message, '$.level'), ''),
+    json_extract(message, '$.job'),
+    COALESCE(json_extract(message, '$.message'), ''),
+    NULLIF(json_remove(message, '$.time', '$.level', '$.job', '$.message'), '{}')
+FROM log
+WHERE job = '_cheek' AND json_valid(message)
+ORDER BY id;
+
+INSERT INTO core_log (time, message)
+SELECT triggered_at, COALESCE(message, '')
+FROM log
+WHERE job = '_cheek' AND NOT json_valid(COALESCE(message, ''))
+ORDER BY id;
+
+DELETE FROM log WHERE job = '_cheek';
@@ -0,0 +1,18 @@
+-- full-text index over the output of runs, kept in sync with the log table
+CREATE VIRTUAL TABLE log_search USING fts5(message, content='log', content_rowid='id');
+
+CREATE TRIGGER log_search_insert AFTER INSERT ON log BEGIN
+    INSERT INTO log_search (rowid, message) VALUES (new.id, new.message);
+END;
+
+CREATE TRIGGER log_search_delete AFTER DELETE ON log BEGIN
+    INSERT INTO log_search (log_search, rowid, message) VALUES ('delete', old.id, old.message);
+END;
+
+CREATE TRIGGER log_search_update AFTER UPDATE OF message ON log BEGIN
+    INSERT INTO log_search (log_search, rowid, message) VALUES ('delete', old.id, old.message);
+    INSERT INTO log_search (rowid, message) VALUES (new.id, new.message);
+END;
+
+-- index the runs that are already there
+INSERT INTO log_search (log_search) VALUES ('rebuild');
@@ -0,0 +1 @@
+ALTER TABLE log ADD COLUMN params TEXT;
@@ -0,0 +1,189 @@
+package cheek
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output streams of job runs, as stored in the log_lines table.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	// StreamCheek holds the messages cheek adds to a run's output
+	StreamCheek = "cheek"
+)
+
+const (
+	// logLinesFlushInterval is how often captured output gets written to the store
+	logLinesFlushInterval = time.Second
+	// logLinesBatchSize is the number of pending lines that triggers an early flush
+	logLinesBatchSize = 100
+)
+
+// outputCapture collects the output of a job run. All output goes to the
+// run's log buffer, and is split into lines that get written to the
+// log_lines table in batches while the job runs.
+type outputCapture struct {
+	j        *JobSpec
+	jobRunID int
+
+	mu         sync.Mutex
+	buf        *bytes.Buffer
+	echo       io.Writer
+	streams    []*streamWriter
+	lineNumber int
+	pending    []LogLine
+
+	flushes chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// newOutputCapture starts capturing output for a job run, line numbers
+// continue from lineNumber so retries append to the output of earlier attempts.
+func newOutputCapture(j *JobSpec, jr *JobRun, echo io.Writer) *outputCapture {
+	c := &outputCapture{
+		j:          j,
+		jobRunID:   jr.LogEntryId,
+		buf:        &jr.logBuf,
+		echo:       echo,
+		lineNumber: jr.lines,
+		flushes:    make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+
+	if c.persist() {
+		go c.run()
+	} else {
+		close(c.stopped)
+	}
+	return c
+}
+
+// persist tells whether lines get written to the store.
+func (c *outputCapture) persist() bool {
+	return c.j.cfg.Store != nil && c.jobRunID != 0
+}
+
+// stream returns a writer for one of the output streams.
+func (c *outputCapture) stream(name string) io.Writer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sw := &streamWriter{c: c, name: name}
+	c.streams = append(c.streams, sw)
+	return sw
+}
+
+// addLine queues a line for writing to the store, c.mu should be held.
+func (c *outputCapture) addLine(stream string, content string) {
+	c.lineNumber++
+	if !c.persist() {
+		return
+	}
+
+	c.pending = append(c.pending, LogLine{
+		JobRunID:   c.jobRunID,
+		LineNumber: c.lineNumber,
+		Timestamp:  time.Now().Format(time.RFC3339Nano),
+		Content:    content,
+		Stream:     stream,
+	})
+	if len(c.pending) >= logLinesBatchSize {
+		select {
+		case c.flushes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *outputCapture) run() {
+	defer close(c.stopped)
+	ticker := time.NewTicker(logLinesFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case <-c.flushes:
+			c.flush()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// flush writes the pending lines to the store.
+func (c *outputCapture) flush() {
+	c.mu.Lock()
+	lines := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	if len(lines) == 0 {
+		return
+	}
+	if err := c.j.cfg.Store.AppendLogLines(lines); err != nil {
+		c.j.log.Warn().Str("job", c.j.Name).Err(err).Msg("Couldn't save job output.")
+	}
+}
+
+// close writes out incomplete last lines and any pending lines,
+// it returns the number of the last line.
+func (c *outputCapture) close() int {
+	c.mu.Lock()
+	for _, sw := range c.streams {
+		if len(sw.partial) > 0 {
+			c.addLine(sw.name, string(sw.partial))
+			sw.partial = nil
+		}
+	}
+	c.mu.Unlock()
+
+	close(c.done)
+	<-c.stopped
+	if c.persist() {
+		c.flush()
+	}
+	return c.lineNumber
+}
+
+// streamWriter writes the output of a single stream, keeping
+// the incomplete last line around until it's complete.
+type streamWriter struct {
+	c       *outputCapture
+	name    string
+	partial []byte
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	c := sw.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err := c.buf.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if c.echo != nil {
+		if _, err := c.echo.Write(p); err != nil {
+			return n, err
+		}
+	}
+
+	data := append(sw.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		c.addLine(sw.name, strings.TrimSuffix(string(data[:i]), "\r"))
+		data = data[i+1:]
+	}
+	sw.partial = append([]byte(nil), data...)
+	return n, nil
+}
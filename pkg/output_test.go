@@ -0,0 +1,114 @@
+package cheek
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputCapture(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	// the in-memory db only lives on a single connection
+	db.SetMaxOpenConns(1)
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	cfg.Store = NewSQLiteStore(db)
+
+	j := &JobSpec{
+		Name:    "test",
+		Command: []string{"sh", "-c", "echo out; echo err >&2; sleep 2; printf 'no newline'"},
+		cfg:     cfg,
+	}
+	jr := j.setup("test", nil)
+
+	done := make(chan JobRun)
+	go func() { done <- j.execCommand(jr, "test") }()
+
+	// lines get written while the job is still running
+	assert.Eventually(t, func() bool {
+		lines, err := GetLogLines(db, jr.LogEntryId, 0)
+		return err == nil && len(lines) == 2
+	}, 1900*time.Millisecond, 50*time.Millisecond)
+
+	jr = <-done
+	lines, err := GetLogLines(db, jr.LogEntryId, 0)
+	assert.NoError(t, err)
+
+	// stdout and stderr are read concurrently, so the first two lines can
+	// be numbered in either order
+	var got []string
+	var numbers []int
+	for _, l := range lines {
+		got = append(got, fmt.Sprintf("%s %s", l.Stream, l.Content))
+		numbers = append(numbers, l.LineNumber)
+	}
+	if assert.Len(t, got, 3) {
+		assert.ElementsMatch(t, []string{"stdout out", "stderr err"}, got[:2])
+		assert.ElementsMatch(t, []int{1, 2}, numbers[:2])
+		assert.Equal(t, "stdout no newline", got[2])
+		assert.Equal(t, 3, numbers[2])
+	}
+	assert.Equal(t, 3, jr.lines)
+
+	jr.flushLogBuffer()
+	assert.Contains(t, jr.Log, "out\n")
+	assert.Contains(t, jr.Log, "err\n")
+}
+
+func TestOutputCaptureRetries(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	cfg.Store = NewSQLiteStore(db)
+
+	j := &JobSpec{
+		Name:       "test",
+		Command:    []string{"sh", "-c", "echo attempt; exit 1"},
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+		cfg:        cfg,
+	}
+	jr := j.execCommandWithRetry("test")
+
+	// line numbers of the retry continue after those of the first attempt
+	lines, err := GetLogLines(db, jr.LogEntryId, 0)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 2)
+	for i, l := range lines {
+		assert.Equal(t, i+1, l.LineNumber)
+		assert.Equal(t, "attempt", l.Content)
+	}
+}
+
+func TestOutputCaptureTimeout(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	cfg.Store = NewSQLiteStore(db)
+
+	j := &JobSpec{
+		Name:    "test",
+		Command: []string{"sleep", "10"},
+		Timeout: 100 * time.Millisecond,
+		cfg:     cfg,
+	}
+	jr := j.execCommand(j.setup("test", nil), "test")
+
+	lines, err := GetLogLines(db, jr.LogEntryId, 0)
+	assert.NoError(t, err)
+	if assert.NotEmpty(t, lines) {
+		last := lines[len(lines)-1]
+		assert.Equal(t, StreamCheek, last.Stream)
+		assert.Equal(t, "Job timed out after 100ms", last.Content)
+	}
+}
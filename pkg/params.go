@@ -0,0 +1,252 @@
+package cheek
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Param types
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+	ParamDate   = "date"
+)
+
+// paramName matches the names of params, which double as env var names.
+var paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedEnv are env vars that params can't override, as they change how
+// the command or the programs it starts behave.
+var reservedEnv = []string{"PATH", "HOME", "SHELL", "USER", "LOGNAME", "PWD", "IFS", "TMPDIR", "LANG", "TZ", "ENV", "BASH_ENV", "PS4", "CDPATH", "PYTHONPATH", "PERL5LIB", "NODE_OPTIONS"}
+
+// reservedEnvPrefixes are prefixes of env vars params can't override.
+var reservedEnvPrefixes = []string{"LD_", "DYLD_", "LC_", "BASH_FUNC_", "CHEEK_"}
+
+// Param defines an input of a job, which is given when the job is triggered
+// by hand. Params are passed to the command as env vars and can be used in
+// the command as a template, e.g. {{ .date }}. Values are spliced into the
+// command as is, so Allowed or Pattern should restrict string params that
+// end up in a shell.
+type Param struct {
+	Name     string   `yaml:"name" json:"name"`
+	Type     string   `yaml:"type,omitempty" json:"type,omitempty"`
+	Default  string   `yaml:"default,omitempty" json:"default,omitempty"`
+	Required bool     `yaml:"required,omitempty" json:"required,omitempty"`
+	Allowed  []string `yaml:"allowed,omitempty" json:"allowed,omitempty"`
+	// Pattern is a regular expression values have to match as a whole
+	Pattern string `yaml:"pattern,omitempty" json:"pattern,omitempty"`
+}
+
+// RunParams are the param values a run was triggered with.
+type RunParams map[string]string
+
+// Value and Scan store params as a JSON object.
+func (p RunParams) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (p *RunParams) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	case []byte:
+		return json.Unmarshal(v, p)
+	default:
+		return fmt.Errorf("cannot scan %T into params", src)
+	}
+}
+
+// check returns whether a value is valid for the param.
+func (p Param) check(v string) error {
+	switch p.Type {
+	case "", ParamString:
+	case ParamInt:
+		if _, err := strconv.Atoi(v); err != nil {
+			return fmt.Errorf("param '%s' should be an int", p.Name)
+		}
+	case ParamBool:
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("param '%s' should be true or false", p.Name)
+		}
+	case ParamDate:
+		if _, err := time.Parse(time.DateOnly, v); err != nil {
+			return fmt.Errorf("param '%s' should be a date such as 2024-05-01", p.Name)
+		}
+	}
+	if len(p.Allowed) > 0 && !slices.Contains(p.Allowed, v) {
+		return fmt.Errorf("param '%s' should be one of %s", p.Name, strings.Join(p.Allowed, ", "))
+	}
+	if p.Pattern != "" {
+		if ok, err := regexp.MatchString(`^(?:`+p.Pattern+`)$`, v); err != nil || !ok {
+			return fmt.Errorf("param '%s' should match %s", p.Name, p.Pattern)
+		}
+	}
+	return nil
+}
+
+// isReservedEnv tells whether a param name would override an env var
+// that shouldn't be set by whoever triggers a job.
+func isReservedEnv(name string) bool {
+	if slices.Contains(reservedEnv, name) {
+		return true
+	}
+	for _, prefix := range reservedEnvPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateParams checks the param specs of the job and its command template.
+func (j *JobSpec) ValidateParams() error {
+	seen := map[string]bool{}
+	for _, p := range j.Params {
+		if !paramName.MatchString(p.Name) {
+			return fmt.Errorf("param name '%s' for job '%s' not valid, should consist of letters, digits and underscores", p.Name, j.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("param '%s' for job '%s' is defined more than once", p.Name, j.Name)
+		}
+		seen[p.Name] = true
+		if isReservedEnv(p.Name) {
+			return fmt.Errorf("param name '%s' for job '%s' not valid, it would override a reserved env var", p.Name, j.Name)
+		}
+		if _, ok := j.Env[p.Name]; ok {
+			return fmt.Errorf("param '%s' for job '%s' conflicts with an env var of the same name", p.Name, j.Name)
+		}
+		switch p.Type {
+		case "", ParamString, ParamInt, ParamBool, ParamDate:
+		default:
+			return fmt.Errorf("type '%s' of param '%s' for job '%s' not valid, should be one of %s, %s, %s or %s", p.Type, p.Name, j.Name, ParamString, ParamInt, ParamBool, ParamDate)
+		}
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("pattern of param '%s' for job '%s' not valid: %w", p.Name, j.Name, err)
+		}
+		for _, v := range p.Allowed {
+			if err := (Param{Name: p.Name, Type: p.Type, Pattern: p.Pattern}).check(v); err != nil {
+				return fmt.Errorf("allowed value '%s' for job '%s': %w", v, j.Name, err)
+			}
+		}
+		if p.Default != "" {
+			if err := p.check(p.Default); err != nil {
+				return fmt.Errorf("default of job '%s': %w", j.Name, err)
+			}
+		}
+	}
+	if j.Cron != "" && !j.defaultsSuffice() {
+		return fmt.Errorf("job '%s' has a cron but required params without a default", j.Name)
+	}
+	if _, err := j.command(nil); err != nil {
+		return fmt.Errorf("command of job '%s': %w", j.Name, err)
+	}
+	return nil
+}
+
+// defaultsSuffice tells whether the job can run without being given params.
+func (j *JobSpec) defaultsSuffice() bool {
+	_, err := j.resolveParams(nil)
+	return err == nil
+}
+
+// defaultParams returns the params of runs that are triggered without
+// any, validation made sure the defaults suffice for those.
+func (j *JobSpec) defaultParams() RunParams {
+	params, _ := j.resolveParams(nil)
+	return params
+}
+
+// resolveParams validates the param values a job is triggered with and
+// fills in the defaults of the params that aren't given.
+func (j *JobSpec) resolveParams(values map[string]string) (RunParams, error) {
+	if len(j.Params) == 0 {
+		if len(values) > 0 {
+			return nil, fmt.Errorf("job '%s' takes no params", j.Name)
+		}
+		return nil, nil
+	}
+
+	params := RunParams{}
+	for _, p := range j.Params {
+		v, ok := values[p.Name]
+		if !ok || v == "" {
+			if p.Required && p.Default == "" {
+				return nil, fmt.Errorf("param '%s' is required", p.Name)
+			}
+			v = p.Default
+		}
+		if v != "" {
+			if err := p.check(v); err != nil {
+				return nil, err
+			}
+		}
+		params[p.Name] = v
+	}
+	for name := range values {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("unknown param '%s'", name)
+		}
+	}
+	return params, nil
+}
+
+// commandTemplates parses the args of the command as templates, if the
+// job has params. Commands of jobs without params are taken as is.
+func (j *JobSpec) commandTemplates() ([]*template.Template, error) {
+	if len(j.Params) == 0 {
+		return nil, nil
+	}
+	tmpls := make([]*template.Template, len(j.Command))
+	for i, arg := range j.Command {
+		t, err := template.New(fmt.Sprintf("arg%d", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		tmpls[i] = t
+	}
+	return tmpls, nil
+}
+
+// command returns the command of the job with the params of a run filled in.
+func (j *JobSpec) command(params RunParams) ([]string, error) {
+	tmpls, err := j.commandTemplates()
+	if err != nil || tmpls == nil {
+		return j.Command, err
+	}
+	// params that weren't given are left empty rather than missing
+	data := map[string]string{}
+	for _, p := range j.Params {
+		data[p.Name] = ""
+	}
+	maps.Copy(data, params)
+
+	args := make([]string, len(tmpls))
+	for i, t := range tmpls {
+		var b bytes.Buffer
+		if err := t.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		args[i] = b.String()
+	}
+	return args, nil
+}
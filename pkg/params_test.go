@@ -0,0 +1,179 @@
+package cheek
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateParams(t *testing.T) {
+	for name, scenario := range map[string]struct {
+		job     *JobSpec
+		wantErr string
+	}{
+		"valid":                         {job: &JobSpec{Command: []string{"echo", "{{ .date }}"}, Params: []Param{{Name: "date", Type: ParamDate, Required: true}, {Name: "env", Allowed: []string{"dev", "prd"}, Default: "dev"}}}},
+		"invalid name":                  {job: &JobSpec{Params: []Param{{Name: "the-date"}}}, wantErr: "not valid"},
+		"reserved name":                 {job: &JobSpec{Params: []Param{{Name: "PATH"}}}, wantErr: "reserved env var"},
+		"reserved prefix":               {job: &JobSpec{Params: []Param{{Name: "LD_PRELOAD"}}}, wantErr: "reserved env var"},
+		"invalid pattern":               {job: &JobSpec{Params: []Param{{Name: "table", Pattern: "[a-z"}}}, wantErr: "pattern of param"},
+		"default not matching pattern":  {job: &JobSpec{Params: []Param{{Name: "table", Pattern: "[a-z_]+", Default: "users; rm"}}}, wantErr: "should match"},
+		"duplicate":                     {job: &JobSpec{Params: []Param{{Name: "date"}, {Name: "date"}}}, wantErr: "more than once"},
+		"env clash":                     {job: &JobSpec{Env: map[string]secret{"date": "x"}, Params: []Param{{Name: "date"}}}, wantErr: "conflicts with an env var"},
+		"unknown type":                  {job: &JobSpec{Params: []Param{{Name: "n", Type: "float"}}}, wantErr: "type 'float'"},
+		"invalid allowed":               {job: &JobSpec{Params: []Param{{Name: "n", Type: ParamInt, Allowed: []string{"1", "two"}}}}, wantErr: "should be an int"},
+		"invalid default":               {job: &JobSpec{Params: []Param{{Name: "flag", Type: ParamBool, Default: "maybe"}}}, wantErr: "true or false"},
+		"default not allowed":           {job: &JobSpec{Params: []Param{{Name: "env", Allowed: []string{"dev"}, Default: "prd"}}}, wantErr: "one of dev"},
+		"required on cron":              {job: &JobSpec{Cron: "* * * * *", Params: []Param{{Name: "date", Required: true}}}, wantErr: "required params without a default"},
+		"required with default on cron": {job: &JobSpec{Cron: "* * * * *", Params: []Param{{Name: "date", Required: true, Default: "2024-05-01"}}}},
+		"unknown param in command":      {job: &JobSpec{Command: []string{"echo", "{{ .day }}"}, Params: []Param{{Name: "date"}}}, wantErr: "command of job"},
+		"broken template":               {job: &JobSpec{Command: []string{"echo", "{{ .date"}, Params: []Param{{Name: "date"}}}, wantErr: "command of job"},
+		"no params, no templating":      {job: &JobSpec{Command: []string{"echo", "{{ .date }}"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			scenario.job.Name = "test"
+			err := scenario.job.ValidateParams()
+			if scenario.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, scenario.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveParams(t *testing.T) {
+	j := &JobSpec{Name: "test", Params: []Param{
+		{Name: "date", Type: ParamDate, Required: true},
+		{Name: "limit", Type: ParamInt, Default: "10"},
+		{Name: "dry_run", Type: ParamBool},
+		{Name: "table", Pattern: "[a-z_]+"},
+	}}
+
+	params, err := j.resolveParams(map[string]string{"date": "2024-05-01", "dry_run": "true"})
+	assert.NoError(t, err)
+	assert.Equal(t, RunParams{"date": "2024-05-01", "limit": "10", "dry_run": "true", "table": ""}, params)
+
+	for values, wantErr := range map[string]string{
+		"limit=5":                     "param 'date' is required",
+		"date=yesterday":              "should be a date",
+		"date=2024-05-01&limit=x":     "should be an int",
+		"date=2024-05-01&foo=bar":     "unknown param 'foo'",
+		"date=2024-05-01&table=x%3By": "param 'table' should match [a-z_]+",
+	} {
+		q, _ := url.ParseQuery(values)
+		given := map[string]string{}
+		for k := range q {
+			given[k] = q.Get(k)
+		}
+		_, err := j.resolveParams(given)
+		assert.ErrorContains(t, err, wantErr, values)
+	}
+
+	_, err = (&JobSpec{Name: "plain"}).resolveParams(map[string]string{"date": "2024-05-01"})
+	assert.ErrorContains(t, err, "takes no params")
+}
+
+func TestParamsInCommand(t *testing.T) {
+	j := &JobSpec{
+		Name:    "backfill",
+		Command: []string{"sh", "-c", "echo from {{ .date }} $date limit={{ .limit }}"},
+		Params:  []Param{{Name: "date", Type: ParamDate}, {Name: "limit", Type: ParamInt}},
+		cfg:     NewConfig(),
+	}
+	j.cfg.SuppressLogs = true
+	assert.NoError(t, j.ValidateParams())
+
+	jr := j.execCommand(j.setup("test", RunParams{"date": "2024-05-01", "limit": ""}), "test")
+	jr.flushLogBuffer()
+	assert.Equal(t, StatusOK, *jr.Status)
+	assert.Contains(t, jr.Log, "from 2024-05-01 2024-05-01 limit=\n")
+}
+
+func TestStoreParams(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			ok := StatusOK
+			jr := &JobRun{Name: "job", TriggeredAt: time.Now().UTC().Truncate(time.Second), TriggeredBy: "ui", Status: &ok, Params: RunParams{"date": "2024-05-01"}}
+			assert.NoError(t, store.SaveJobRun(jr))
+
+			got, err := store.JobRun("job", jr.LogEntryId)
+			assert.NoError(t, err)
+			assert.Equal(t, RunParams{"date": "2024-05-01"}, got.Params)
+
+			page, err := store.Runs(RunQuery{Job: "job"})
+			assert.NoError(t, err)
+			if assert.Len(t, page.Runs, 1) {
+				assert.Equal(t, RunParams{"date": "2024-05-01"}, page.Runs[0].Params)
+			}
+		})
+	}
+}
+
+func TestTriggerWithParams(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, `
+jobs:
+  backfill:
+    command: [sh, -c, "echo backfilling {{ .date }} for $env"]
+    params:
+      - name: date
+        type: date
+        required: true
+      - name: env
+        allowed: [dev, prd]
+        default: dev
+`)
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	cfg.SuppressLogs = true
+	s, err := loadSchedule(zerolog.Nop(), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trigger := func(contentType string, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/jobs/backfill/trigger?wait=true", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		setupRouter(s).ServeHTTP(resp, req)
+		return resp
+	}
+
+	// as JSON
+	resp := trigger("application/json", `{"date": "2024-05-01", "env": "prd"}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var tr TriggerResponse
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tr))
+	if assert.NotNil(t, tr.Run) {
+		assert.Equal(t, RunParams{"date": "2024-05-01", "env": "prd"}, tr.Run.Params)
+		assert.Contains(t, tr.Run.Log, "backfilling 2024-05-01 for prd")
+	}
+
+	// as a form, with the default filled in
+	resp = trigger("application/x-www-form-urlencoded", "date=2024-05-02")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	tr = TriggerResponse{}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &tr))
+	if assert.NotNil(t, tr.Run) {
+		assert.Equal(t, RunParams{"date": "2024-05-02", "env": "dev"}, tr.Run.Params)
+	}
+
+	for body, wantErr := range map[string]string{
+		`{}`:                                 "param 'date' is required",
+		`{"date": "2024-05-01", "env": "x"}`: "should be one of dev, prd",
+		`{"date": ["2024-05-01"]}`:           "error:",
+		`[1, 2]`:                             "error:",
+	} {
+		resp := trigger("application/json", body)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+		assert.Contains(t, resp.Body.String(), wantErr, body)
+	}
+}
@@ -0,0 +1,179 @@
+package cheek
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueuedRun describes a run that waits for a free worker.
+type QueuedRun struct {
+	Id          int       `json:"id,omitempty"`
+	Job         string    `json:"job"`
+	Priority    int       `json:"priority"`
+	TriggeredAt time.Time `json:"triggered_at"`
+	TriggeredBy string    `json:"triggered_by"`
+	WaitingFor  string    `json:"waiting_for,omitempty"`
+	ready       chan struct{}
+	seq         int
+	index       int
+}
+
+func (qr *QueuedRun) before(other *QueuedRun) bool {
+	switch {
+	case qr.Priority != other.Priority:
+		return qr.Priority > other.Priority
+	case !qr.TriggeredAt.Equal(other.TriggeredAt):
+		return qr.TriggeredAt.Before(other.TriggeredAt)
+	default:
+		return qr.seq < other.seq
+	}
+}
+
+// runQueue orders queued runs by priority, then by due time.
+type runQueue []*QueuedRun
+
+func (q runQueue) Len() int { return len(q) }
+
+func (q runQueue) Less(i, k int) bool { return q[i].before(q[k]) }
+
+func (q runQueue) Swap(i, k int) {
+	q[i], q[k] = q[k], q[i]
+	q[i].index = i
+	q[k].index = k
+}
+
+func (q *runQueue) Push(x any) {
+	qr := x.(*QueuedRun)
+	qr.index = len(*q)
+	*q = append(*q, qr)
+}
+
+func (q *runQueue) Pop() any {
+	old := *q
+	n := len(old)
+	qr := old[n-1]
+	old[n-1] = nil
+	qr.index = -1
+	*q = old[:n-1]
+	return qr
+}
+
+// workerPool limits the number of job runs that execute at the same
+// time, a limit of 0 means no limit. Concurrency groups use it as well,
+// in which case it carries the name of the group.
+type workerPool struct {
+	name    string
+	mu      sync.Mutex
+	limit   int
+	running int
+	seq     int
+	queue   runQueue
+}
+
+func newWorkerPool(limit int) *workerPool {
+	return &workerPool{limit: limit}
+}
+
+// QueueStatus holds a snapshot of the state of the worker pool.
+type QueueStatus struct {
+	MaxParallelJobs int         `json:"max_parallel_jobs"`
+	Running         int         `json:"running"`
+	Depth           int         `json:"depth"`
+	Runs            []QueuedRun `json:"runs"`
+}
+
+func (p *workerPool) free() bool {
+	return p.limit <= 0 || p.running < p.limit
+}
+
+// dispatch hands out free workers to queued runs, p.mu should be held.
+func (p *workerPool) dispatch() {
+	for p.queue.Len() > 0 && p.free() {
+		qr := heap.Pop(&p.queue).(*QueuedRun)
+		p.running++
+		close(qr.ready)
+	}
+}
+
+// tryAcquire takes a worker if one is free and no other runs are waiting.
+func (p *workerPool) tryAcquire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.queue.Len() > 0 || !p.free() {
+		return false
+	}
+	p.running++
+	return true
+}
+
+// acquire queues the run until it gets a worker or the context is done.
+func (p *workerPool) acquire(ctx context.Context, jr *JobRun, priority int) error {
+	qr := &QueuedRun{
+		Id:          jr.LogEntryId,
+		Job:         jr.Name,
+		Priority:    priority,
+		TriggeredAt: jr.TriggeredAt,
+		TriggeredBy: jr.TriggeredBy,
+		WaitingFor:  p.name,
+		ready:       make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	p.seq++
+	qr.seq = p.seq
+	heap.Push(&p.queue, qr)
+	p.dispatch()
+	p.mu.Unlock()
+
+	select {
+	case <-qr.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	if qr.index >= 0 {
+		heap.Remove(&p.queue, qr.index)
+		p.mu.Unlock()
+		return ctx.Err()
+	}
+	p.mu.Unlock()
+	// got a worker at the same time the context got cancelled
+	p.release()
+	return ctx.Err()
+}
+
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running--
+	p.dispatch()
+}
+
+// resize changes the limit, for instance after the schedule got reloaded.
+func (p *workerPool) resize(limit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.limit = limit
+	p.dispatch()
+}
+
+func (p *workerPool) status() QueueStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	qs := QueueStatus{
+		MaxParallelJobs: p.limit,
+		Running:         p.running,
+		Depth:           len(p.queue),
+		Runs:            make([]QueuedRun, 0, len(p.queue)),
+	}
+	for _, qr := range p.queue {
+		qs.Runs = append(qs.Runs, *qr)
+	}
+	sort.Slice(qs.Runs, func(i, k int) bool { return qs.Runs[i].before(&qs.Runs[k]) })
+	return qs
+}
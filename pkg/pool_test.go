@@ -0,0 +1,99 @@
+package cheek
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolOrder(t *testing.T) {
+	p := newWorkerPool(1)
+	assert.True(t, p.tryAcquire())
+	assert.False(t, p.tryAcquire())
+
+	now := time.Now()
+	runs := []JobRun{
+		{Name: "late", TriggeredAt: now.Add(time.Second)},
+		{Name: "early", TriggeredAt: now},
+		{Name: "urgent", TriggeredAt: now.Add(2 * time.Second)},
+	}
+	priorities := []int{0, 0, 10}
+
+	started := make(chan string, len(runs))
+	for i := range runs {
+		go func(jr JobRun, priority int) {
+			if err := p.acquire(context.Background(), &jr, priority); err == nil {
+				started <- jr.Name
+			}
+		}(runs[i], priorities[i])
+	}
+	assert.Eventually(t, func() bool { return p.status().Depth == 3 }, time.Second, 10*time.Millisecond)
+
+	qs := p.status()
+	assert.Equal(t, 1, qs.Running)
+	assert.Equal(t, []string{"urgent", "early", "late"}, []string{qs.Runs[0].Job, qs.Runs[1].Job, qs.Runs[2].Job})
+
+	for _, want := range []string{"urgent", "early", "late"} {
+		p.release()
+		select {
+		case got := <-started:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatalf("%s did not start", want)
+		}
+	}
+	assert.Equal(t, 0, p.status().Depth)
+}
+
+func TestWorkerPoolCancel(t *testing.T) {
+	p := newWorkerPool(1)
+	assert.True(t, p.tryAcquire())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.acquire(ctx, &JobRun{Name: "test"}, 0) }()
+	assert.Eventually(t, func() bool { return p.status().Depth == 1 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, 0, p.status().Depth)
+
+	p.release()
+	assert.Equal(t, 0, p.status().Running)
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	p := newWorkerPool(1)
+	assert.True(t, p.tryAcquire())
+
+	done := make(chan error)
+	go func() { done <- p.acquire(context.Background(), &JobRun{Name: "test"}, 0) }()
+	assert.Eventually(t, func() bool { return p.status().Depth == 1 }, time.Second, 10*time.Millisecond)
+
+	p.resize(2)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 2, p.status().Running)
+}
+
+func TestMaxParallelJobs(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+
+	s := &Schedule{loc: time.UTC, cfg: cfg, pool: newWorkerPool(1)}
+	j := &JobSpec{
+		Name:           "test",
+		Command:        []string{"sleep", "0.3"},
+		cfg:            cfg,
+		globalSchedule: s,
+	}
+
+	start := time.Now()
+	runs := runConcurrently(j, 3)
+
+	assert.Equal(t, 3, countStatus(runs, StatusOK))
+	// runs don't overlap, so they take at least three times as long
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+	assert.Equal(t, QueueStatus{MaxParallelJobs: 1, Runs: []QueuedRun{}}, s.pool.status())
+}
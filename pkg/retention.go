@@ -0,0 +1,220 @@
+package cheek
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+)
+
+// housekeepingInterval is how often the scheduler prunes the store.
+const housekeepingInterval = time.Hour
+
+// Retention defines how long the runs of a job are kept around, runs
+// beyond either limit get deleted. A limit of 0 means no limit.
+type Retention struct {
+	KeepRuns int `yaml:"keep_runs,omitempty" json:"keep_runs,omitempty"`
+	KeepDays int `yaml:"keep_days,omitempty" json:"keep_days,omitempty"`
+}
+
+// CoreLogRetention defines how long core logs are kept around.
+type CoreLogRetention struct {
+	KeepLines int `yaml:"keep_lines,omitempty" json:"keep_lines,omitempty"`
+	KeepDays  int `yaml:"keep_days,omitempty" json:"keep_days,omitempty"`
+}
+
+func (r Retention) validate() error {
+	if r.KeepRuns < 0 || r.KeepDays < 0 {
+		return fmt.Errorf("keep_runs and keep_days cannot be negative")
+	}
+	return nil
+}
+
+func (r CoreLogRetention) validate() error {
+	if r.KeepLines < 0 || r.KeepDays < 0 {
+		return fmt.Errorf("keep_lines and keep_days cannot be negative")
+	}
+	return nil
+}
+
+// merge returns the retention with the limits that are set on other
+// taking precedence.
+func (r Retention) merge(other Retention) Retention {
+	if other.KeepRuns != 0 {
+		r.KeepRuns = other.KeepRuns
+	}
+	if other.KeepDays != 0 {
+		r.KeepDays = other.KeepDays
+	}
+	return r
+}
+
+// cutoff returns the time before which entries are pruned, a
+// zero time if entries should not be pruned based on age.
+func cutoff(keepDays int, now time.Time) time.Time {
+	if keepDays == 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -keepDays)
+}
+
+// pruneLog deletes the entries of a job in the log table beyond keep
+// entries or from before the cutoff, together with their log lines.
+// Entries of runs that are still queued or running are never deleted.
+func pruneLog(tx *sqlx.Tx, job string, keep int, before time.Time) (int64, error) {
+	if keep == 0 && before.IsZero() {
+		return 0, nil
+	}
+	// a negative limit means no limit for sqlite
+	if keep == 0 {
+		keep = -1
+	}
+	var olderThan any
+	if !before.IsZero() {
+		olderThan = before.UTC().Format("2006-01-02 15:04:05")
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM log
+		WHERE job = ?
+			AND COALESCE(is_running, 0) = 0 AND COALESCE(is_queued, 0) = 0
+			AND (
+				julianday(triggered_at) < julianday(?)
+				OR id NOT IN (SELECT id FROM log WHERE job = ? ORDER BY triggered_at DESC, id DESC LIMIT ?)
+			)`,
+		job, olderThan, job, keep)
+	if err != nil {
+		return 0, fmt.Errorf("prune log: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("prune log: %w", err)
+	}
+
+	if n > 0 {
+		_, err = tx.Exec(`DELETE FROM log_lines WHERE job_run_id NOT IN (SELECT id FROM log)`)
+		if err != nil {
+			return 0, fmt.Errorf("prune log lines: %w", err)
+		}
+	}
+
+	return n, nil
+}
+
+// VacuumDB returns the space freed up by pruning to the file system. A full
+// vacuum rebuilds the db file and switches it to incremental vacuuming,
+// otherwise only an incremental vacuum is done, which is a no-op for db files
+// that weren't switched yet.
+func VacuumDB(db *sqlx.DB, full bool) error {
+	if !full {
+		if _, err := db.Exec("PRAGMA incremental_vacuum"); err != nil {
+			return fmt.Errorf("incremental vacuum: %w", err)
+		}
+		return nil
+	}
+
+	// the pragma only applies to the connection it's set on
+	conn, err := db.Connx(context.Background())
+	if err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.ExecContext(context.Background(), "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	if _, err := conn.ExecContext(context.Background(), "VACUUM"); err != nil {
+		return fmt.Errorf("vacuum: %w", err)
+	}
+	return nil
+}
+
+// retention returns the retention that applies to the runs of a job, jobs
+// that are no longer part of the schedule get the schedule's retention.
+func (s *Schedule) retention(job string) Retention {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r := s.Retention
+	if j, ok := s.Jobs[job]; ok {
+		r = r.merge(j.Retention)
+	}
+	return r
+}
+
+// prune deletes runs and core logs that fall outside of their retention.
+func (s *Schedule) prune(now time.Time) error {
+	jobs, err := s.cfg.Store.JobNames()
+	if err != nil {
+		return err
+	}
+
+	var pruned int64
+	for _, job := range jobs {
+		n, err := s.cfg.Store.PruneJobRuns(job, s.retention(job), now)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			s.log.Debug().Str("job", job).Msgf("Pruned %d run(s)", n)
+		}
+		pruned += n
+	}
+
+	s.mu.RLock()
+	coreRetention := s.CoreLogRetention
+	s.mu.RUnlock()
+	n, err := s.cfg.Store.PruneCoreLogs(coreRetention, now)
+	if err != nil {
+		return err
+	}
+
+	if pruned > 0 || n > 0 {
+		s.log.Info().Msgf("Pruned %d run(s) and %d core log line(s)", pruned, n)
+	}
+	return nil
+}
+
+// vacuum frees up space in stores that support it.
+func (s *Schedule) vacuum(full bool) error {
+	if v, ok := s.cfg.Store.(Vacuumer); ok {
+		return v.Vacuum(full)
+	}
+	return nil
+}
+
+// housekeeping periodically prunes the store until the context is done.
+func (s *Schedule) housekeeping(ctx context.Context) {
+	ticker := time.NewTicker(housekeepingInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.prune(s.now()); err != nil {
+			s.log.Warn().Err(err).Msg("Couldn't prune store.")
+		} else if err := s.vacuum(false); err != nil {
+			s.log.Warn().Err(err).Msg("Couldn't vacuum store.")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// PruneDB prunes the db according to the retention settings of a schedule,
+// limits that are set on override take precedence over the schedule's.
+func PruneDB(log zerolog.Logger, cfg Config, scheduleFn string, override Retention, vacuum bool) error {
+	s, err := loadSchedule(log, cfg, scheduleFn)
+	if err != nil {
+		return err
+	}
+	s.Retention = s.Retention.merge(override)
+
+	if err := s.prune(time.Now()); err != nil {
+		return err
+	}
+	return s.vacuum(vacuum)
+}
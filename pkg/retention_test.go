@@ -0,0 +1,155 @@
+package cheek
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// insertRuns adds finished runs of a job, one a day going back from now.
+func insertRuns(t *testing.T, db *sqlx.DB, job string, n int, now time.Time) []int {
+	t.Helper()
+	var ids []int
+	for i := 0; i < n; i++ {
+		status := StatusOK
+		jr := &JobRun{Name: job, TriggeredAt: now.AddDate(0, 0, -i), TriggeredBy: "cron", Status: &status}
+		assert.NoError(t, InsertOrUpdateJobRun(db, jr))
+		assert.NoError(t, InsertLogLine(db, jr.LogEntryId, 1, fmt.Sprintf("run %d", i), "stdout"))
+		ids = append(ids, jr.LogEntryId)
+	}
+	return ids
+}
+
+func countRows(t *testing.T, db *sqlx.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	assert.NoError(t, db.Get(&n, query, args...))
+	return n
+}
+
+func TestPruneJobRuns(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		retention Retention
+		want      int
+	}{
+		{"no limits", Retention{}, 10},
+		{"keep runs", Retention{KeepRuns: 3}, 3},
+		{"keep days", Retention{KeepDays: 5}, 6},
+		{"both", Retention{KeepRuns: 3, KeepDays: 1}, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			defer db.Close()
+
+			insertRuns(t, db, "test", 10, now)
+			insertRuns(t, db, "other", 10, now)
+
+			_, err := NewSQLiteStore(db).PruneJobRuns("test", tc.retention, now.Add(-time.Minute))
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.want, countRows(t, db, "SELECT COUNT(*) FROM log WHERE job = 'test'"))
+			assert.Equal(t, 10, countRows(t, db, "SELECT COUNT(*) FROM log WHERE job = 'other'"))
+			// log lines of pruned runs are gone as well
+			assert.Equal(t, tc.want+10, countRows(t, db, "SELECT COUNT(*) FROM log_lines"))
+		})
+	}
+}
+
+func TestPruneJobRunsKeepsActiveRuns(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	now := time.Now()
+	running := &JobRun{Name: "test", TriggeredAt: now.AddDate(0, 0, -10), TriggeredBy: "cron"}
+	assert.NoError(t, InsertOrUpdateJobRun(db, running))
+	insertRuns(t, db, "test", 3, now)
+
+	n, err := NewSQLiteStore(db).PruneJobRuns("test", Retention{KeepRuns: 1, KeepDays: 1}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	var ids []int
+	assert.NoError(t, db.Select(&ids, "SELECT id FROM log WHERE job = 'test' ORDER BY id"))
+	assert.Equal(t, running.LogEntryId, ids[0])
+	assert.Len(t, ids, 2)
+}
+
+func TestPruneCoreLogs(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewSQLiteStore(db)
+	w := NewStoreLogWriter(store)
+	for i := 0; i < 5; i++ {
+		_, err := w.Write([]byte(fmt.Sprintf(`{"message":"line %d"}`, i)))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, store.Flush())
+	insertRuns(t, db, "test", 3, time.Now())
+
+	n, err := store.PruneCoreLogs(CoreLogRetention{KeepLines: 2}, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, 2, countRows(t, db, "SELECT COUNT(*) FROM core_log"))
+	assert.Equal(t, 3, countRows(t, db, "SELECT COUNT(*) FROM log WHERE job = 'test'"))
+}
+
+func TestSchedulePrune(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, `
+retention:
+  keep_runs: 5
+jobs:
+  keep_few:
+    command: echo few
+    retention:
+      keep_runs: 2
+  keep_default:
+    command: echo default
+`)
+	cfg := NewConfig()
+	cfg.Store = NewSQLiteStore(db)
+	s, err := loadSchedule(NewLogger("debug", nil, new(tsBuffer)), cfg, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, job := range []string{"keep_few", "keep_default", "removed"} {
+		insertRuns(t, db, job, 10, now)
+	}
+
+	assert.NoError(t, s.prune(now))
+	assert.Equal(t, 2, countRows(t, db, "SELECT COUNT(*) FROM log WHERE job = 'keep_few'"))
+	assert.Equal(t, 5, countRows(t, db, "SELECT COUNT(*) FROM log WHERE job = 'keep_default'"))
+	// jobs that are no longer part of the schedule get the schedule's retention
+	assert.Equal(t, 5, countRows(t, db, "SELECT COUNT(*) FROM log WHERE job = 'removed'"))
+
+	assert.NoError(t, VacuumDB(db, false))
+	assert.NoError(t, VacuumDB(db, true))
+}
+
+func TestRetentionValidation(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, `
+jobs:
+  test:
+    command: echo test
+    retention:
+      keep_days: -1
+`)
+	_, err := loadSchedule(NewLogger("debug", nil, new(tsBuffer)), Config{}, fn)
+	assert.ErrorContains(t, err, "retention of job 'test'")
+}
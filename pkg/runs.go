@@ -0,0 +1,293 @@
+package cheek
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// defaultRunsLimit is the number of runs returned if no limit is given.
+	defaultRunsLimit = 50
+	// maxRunsLimit is the maximum number of runs returned at once.
+	maxRunsLimit = 500
+)
+
+// States of runs that can be filtered on, next to exit codes.
+const (
+	RunSucceeded = "success"
+	RunFailed    = "failed"
+	RunTimedOut  = "timeout"
+	RunSkipped   = "skipped"
+	RunCancelled = "cancelled"
+	RunRunning   = "running"
+	RunQueued    = "queued"
+)
+
+// Keys runs can be sorted on, a leading - sorts in descending order.
+const (
+	SortTriggeredAt = "triggered_at"
+	SortDuration    = "duration"
+)
+
+// RunQuery filters the history of runs, zero values don't filter.
+type RunQuery struct {
+	Job string
+	// Status holds states or exit codes, runs pass if they match any of them
+	Status []string
+	// TriggeredBy holds triggers, runs pass if they match any of them
+	TriggeredBy []string
+	Since       time.Time
+	Until       time.Time
+	MinDuration time.Duration
+	// Sort is the key to sort on, the newest runs come first by default
+	Sort string
+	// After only returns the runs that come after the run with this id
+	// in the sort order, which allows to page through them
+	After int
+	Limit int
+}
+
+// RunPage is a page of runs.
+type RunPage struct {
+	Runs []JobRun `json:"runs"`
+	// NextCursor is the id to pass as cursor to get the next page,
+	// it's left out on the last page
+	NextCursor int `json:"next_cursor,omitempty"`
+}
+
+func (q RunQuery) limit() int {
+	if q.Limit <= 0 {
+		return defaultRunsLimit
+	}
+	return min(q.Limit, maxRunsLimit)
+}
+
+// order returns the key to sort on and whether to sort descending.
+func (q RunQuery) order() (string, bool, error) {
+	if q.Sort == "" {
+		return SortTriggeredAt, true, nil
+	}
+	key, desc := strings.TrimPrefix(q.Sort, "-"), strings.HasPrefix(q.Sort, "-")
+	if key != SortTriggeredAt && key != SortDuration {
+		return "", false, fmt.Errorf("can't sort on '%s', use one of: %s, %s", key, SortTriggeredAt, SortDuration)
+	}
+	return key, desc, nil
+}
+
+// validate checks the query before it gets run.
+func (q RunQuery) validate() error {
+	for _, s := range q.Status {
+		if _, err := statusCondition(s); err != nil {
+			return fmt.Errorf("status: %w", err)
+		}
+	}
+	if _, _, err := q.order(); err != nil {
+		return fmt.Errorf("sort: %w", err)
+	}
+	return nil
+}
+
+// statusCondition returns the sql condition that selects runs in a state
+// or with an exit code.
+func statusCondition(s string) (string, error) {
+	switch s {
+	case RunSucceeded:
+		return fmt.Sprintf("status = %d", StatusOK), nil
+	case RunFailed:
+		return fmt.Sprintf("status NOT IN (%d, %d, %d, %d)", StatusOK, StatusTimeout, StatusSkipped, StatusCancelled), nil
+	case RunTimedOut:
+		return fmt.Sprintf("status = %d", StatusTimeout), nil
+	case RunSkipped:
+		return fmt.Sprintf("status = %d", StatusSkipped), nil
+	case RunCancelled:
+		return fmt.Sprintf("status = %d", StatusCancelled), nil
+	case RunRunning:
+		return "(status IS NULL AND COALESCE(is_queued, 0) = 0)", nil
+	case RunQueued:
+		return "COALESCE(is_queued, 0) = 1", nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return "", fmt.Errorf("unknown status '%s', use an exit code or one of: %s", s,
+			strings.Join([]string{RunSucceeded, RunFailed, RunTimedOut, RunSkipped, RunCancelled, RunRunning, RunQueued}, ", "))
+	}
+	return fmt.Sprintf("status = %d", code), nil
+}
+
+// hasStatus tells whether a run is in a state or has an exit code.
+func hasStatus(jr JobRun, s string) bool {
+	switch s {
+	case RunRunning:
+		return jr.Status == nil && !jr.Queued
+	case RunQueued:
+		return jr.Queued
+	}
+	if jr.Status == nil {
+		return false
+	}
+	switch s {
+	case RunSucceeded:
+		return *jr.Status == StatusOK
+	case RunFailed:
+		return *jr.Status != StatusOK && *jr.Status != StatusTimeout && *jr.Status != StatusSkipped && *jr.Status != StatusCancelled
+	case RunTimedOut:
+		return *jr.Status == StatusTimeout
+	case RunSkipped:
+		return *jr.Status == StatusSkipped
+	case RunCancelled:
+		return *jr.Status == StatusCancelled
+	}
+	code, err := strconv.Atoi(s)
+	return err == nil && *jr.Status == code
+}
+
+// minDuration returns the minimum duration as stored, in milliseconds.
+func (q RunQuery) minDuration() time.Duration {
+	return time.Duration(q.MinDuration.Milliseconds())
+}
+
+// matches tells whether a run passes the filters of the query.
+func (q RunQuery) matches(jr JobRun) bool {
+	if q.Job != "" && jr.Name != q.Job {
+		return false
+	}
+	if len(q.Status) > 0 {
+		ok := false
+		for _, s := range q.Status {
+			ok = ok || hasStatus(jr, s)
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(q.TriggeredBy) > 0 && !slices.Contains(q.TriggeredBy, jr.TriggeredBy) {
+		return false
+	}
+	if !q.Since.IsZero() && jr.TriggeredAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && jr.TriggeredAt.After(q.Until) {
+		return false
+	}
+	if q.MinDuration > 0 && jr.Duration < q.minDuration() {
+		return false
+	}
+	return true
+}
+
+// sortRuns sorts runs in the order of the query, runs with
+// the same key are ordered by id.
+func (q RunQuery) sortRuns(jrs []JobRun) {
+	key, desc, _ := q.order()
+	sort.SliceStable(jrs, func(a, b int) bool {
+		x, y := jrs[a], jrs[b]
+		if desc {
+			x, y = y, x
+		}
+		switch {
+		case key == SortDuration && x.Duration != y.Duration:
+			return x.Duration < y.Duration
+		case key == SortTriggeredAt && !x.TriggeredAt.Equal(y.TriggeredAt):
+			return x.TriggeredAt.Before(y.TriggeredAt)
+		}
+		return x.LogEntryId < y.LogEntryId
+	})
+}
+
+// page cuts a page out of runs that are sorted and filtered.
+func (q RunQuery) page(jrs []JobRun) RunPage {
+	if q.After > 0 {
+		start := len(jrs)
+		for i, jr := range jrs {
+			if jr.LogEntryId == q.After {
+				start = i + 1
+				break
+			}
+		}
+		jrs = jrs[start:]
+	}
+
+	page := RunPage{Runs: []JobRun{}}
+	if len(jrs) > q.limit() {
+		jrs = jrs[:q.limit()]
+		page.NextCursor = jrs[len(jrs)-1].LogEntryId
+	}
+	page.Runs = append(page.Runs, jrs...)
+	return page
+}
+
+// LoadRuns loads a page of the runs matching the query, without their output.
+func LoadRuns(db *sqlx.DB, q RunQuery) (RunPage, error) {
+	if err := q.validate(); err != nil {
+		return RunPage{}, err
+	}
+
+	var where []string
+	var args []any
+	if q.Job != "" {
+		where = append(where, "job = ?")
+		args = append(args, q.Job)
+	}
+	if len(q.Status) > 0 {
+		var conds []string
+		for _, s := range q.Status {
+			cond, _ := statusCondition(s)
+			conds = append(conds, cond)
+		}
+		where = append(where, "("+strings.Join(conds, " OR ")+")")
+	}
+	if len(q.TriggeredBy) > 0 {
+		where = append(where, "triggered_by IN (?"+strings.Repeat(", ?", len(q.TriggeredBy)-1)+")")
+		for _, t := range q.TriggeredBy {
+			args = append(args, t)
+		}
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "julianday(triggered_at) >= julianday(?)")
+		args = append(args, q.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "julianday(triggered_at) <= julianday(?)")
+		args = append(args, q.Until.UTC().Format(time.RFC3339Nano))
+	}
+	if q.MinDuration > 0 {
+		where = append(where, "duration >= ?")
+		args = append(args, int64(q.minDuration()))
+	}
+
+	key, desc, _ := q.order()
+	expr, dir, cmp := "julianday(triggered_at)", "ASC", ">"
+	if key == SortDuration {
+		expr = "COALESCE(duration, 0)"
+	}
+	if desc {
+		dir, cmp = "DESC", "<"
+	}
+	if q.After > 0 {
+		// the key of the cursor is computed the same way as the keys it's
+		// compared to, a cursor of which the run is gone matches nothing
+		where = append(where, fmt.Sprintf("(%[1]s, id) %[2]s (SELECT %[1]s, id FROM log WHERE id = ?)", expr, cmp))
+		args = append(args, q.After)
+	}
+
+	query := "SELECT id, job, triggered_at, COALESCE(triggered_by, '') AS triggered_by, COALESCE(duration, 0) AS duration, status, COALESCE(is_queued, 0) AS is_queued, params FROM log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s LIMIT ?", expr, dir)
+	// load one run more to know whether there is a next page
+	args = append(args, q.limit()+1)
+
+	var jrs []JobRun
+	if err := db.Select(&jrs, query, args...); err != nil {
+		return RunPage{}, fmt.Errorf("load runs: %w", err)
+	}
+	q.After = 0
+	return q.page(jrs), nil
+}
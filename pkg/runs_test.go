@@ -0,0 +1,138 @@
+package cheek
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreRuns(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			status := func(s int) *int { return &s }
+			runs := []*JobRun{
+				{Name: "backup", TriggeredAt: now.Add(-5 * time.Hour), TriggeredBy: "cron", Status: status(StatusOK), Duration: 2000, Log: "done"},
+				{Name: "backup", TriggeredAt: now.Add(-4 * time.Hour), TriggeredBy: "cron", Status: status(1), Duration: 500},
+				{Name: "backup", TriggeredAt: now.Add(-3 * time.Hour), TriggeredBy: "ui", Status: status(StatusTimeout), Duration: 60000},
+				{Name: "report", TriggeredAt: now.Add(-2 * time.Hour), TriggeredBy: "cron", Status: status(StatusSkipped)},
+				{Name: "report", TriggeredAt: now.Add(-time.Hour), TriggeredBy: "api", Status: status(StatusOK), Duration: 2000},
+				{Name: "report", TriggeredAt: now, TriggeredBy: "cron"},
+				{Name: "backup", TriggeredAt: now, TriggeredBy: "cron", Queued: true},
+			}
+			for _, jr := range runs {
+				assert.NoError(t, store.SaveJobRun(jr))
+			}
+
+			ids := func(q RunQuery) []int {
+				page, err := store.Runs(q)
+				assert.NoError(t, err)
+				var ids []int
+				for _, jr := range page.Runs {
+					ids = append(ids, jr.LogEntryId)
+				}
+				return ids
+			}
+			id := func(i int) int { return runs[i].LogEntryId }
+
+			assert.Equal(t, []int{id(6), id(5), id(4), id(3), id(2), id(1), id(0)}, ids(RunQuery{}))
+			assert.Equal(t, []int{id(2), id(1), id(0)}, ids(RunQuery{Job: "backup", Status: []string{RunSucceeded, RunFailed, RunTimedOut}}))
+			assert.Equal(t, []int{id(1)}, ids(RunQuery{Status: []string{RunFailed}}))
+			assert.Equal(t, []int{id(1)}, ids(RunQuery{Status: []string{"1"}}))
+			assert.Equal(t, []int{id(3)}, ids(RunQuery{Status: []string{RunSkipped}}))
+			assert.Equal(t, []int{id(5)}, ids(RunQuery{Status: []string{RunRunning}}))
+			assert.Equal(t, []int{id(6)}, ids(RunQuery{Status: []string{RunQueued}}))
+			assert.Equal(t, []int{id(4), id(2)}, ids(RunQuery{TriggeredBy: []string{"ui", "api"}}))
+			assert.Equal(t, []int{id(3), id(2)}, ids(RunQuery{Since: now.Add(-3 * time.Hour), Until: now.Add(-2 * time.Hour)}))
+			assert.Equal(t, []int{id(4), id(2), id(0)}, ids(RunQuery{MinDuration: 2 * time.Second}))
+			assert.Equal(t, []int{id(2), id(4), id(0), id(1)}, ids(RunQuery{Sort: "-duration", MinDuration: time.Millisecond}))
+			assert.Equal(t, []int{id(1), id(0), id(4), id(2)}, ids(RunQuery{Sort: "duration", MinDuration: time.Millisecond}))
+
+			// page through the runs
+			var all []int
+			q := RunQuery{Sort: "triggered_at", Limit: 3}
+			for {
+				page, err := store.Runs(q)
+				assert.NoError(t, err)
+				for _, jr := range page.Runs {
+					all = append(all, jr.LogEntryId)
+				}
+				if page.NextCursor == 0 {
+					break
+				}
+				q.After = page.NextCursor
+			}
+			assert.Equal(t, []int{id(0), id(1), id(2), id(3), id(4), id(5), id(6)}, all)
+
+			page, err := store.Runs(RunQuery{Job: "backup", Limit: 1})
+			assert.NoError(t, err)
+			assert.Equal(t, id(6), page.NextCursor)
+			assert.Equal(t, "backup", page.Runs[0].Name)
+			page, err = store.Runs(RunQuery{Job: "backup", Status: []string{RunSucceeded}})
+			assert.NoError(t, err)
+			assert.Empty(t, page.Runs[0].Log)
+			assert.Equal(t, time.Duration(2000), page.Runs[0].Duration)
+			assert.Zero(t, page.NextCursor)
+
+			_, err = store.Runs(RunQuery{Status: []string{"broken"}})
+			assert.Error(t, err)
+			_, err = store.Runs(RunQuery{Sort: "name"})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRunsAPI(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	s := &Schedule{Jobs: map[string]*JobSpec{"backup": {Name: "backup", cfg: cfg}}, cfg: cfg, log: zerolog.Nop()}
+
+	now := time.Now()
+	for i, status := range []int{StatusOK, 1, StatusOK} {
+		jr := &JobRun{Name: "backup", TriggeredAt: now.Add(time.Duration(i) * time.Minute), TriggeredBy: "cron", Status: &status, Duration: 1000}
+		assert.NoError(t, cfg.Store.SaveJobRun(jr))
+	}
+	assert.NoError(t, cfg.Store.SaveJobRun(&JobRun{Name: "report", TriggeredAt: now, TriggeredBy: "ui"}))
+
+	get := func(url string) (*httptest.ResponseRecorder, RunPage) {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		setupRouter(s).ServeHTTP(resp, req)
+		var page RunPage
+		if resp.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+		}
+		return resp, page
+	}
+
+	resp, page := get("/api/runs")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Len(t, page.Runs, 4)
+
+	_, page = get("/api/runs?job=report")
+	assert.Len(t, page.Runs, 1)
+
+	_, page = get("/api/jobs/backup/runs?status=success&triggered_by=cron,ui&since=1h&min_duration=1s&limit=1")
+	assert.Len(t, page.Runs, 1)
+	assert.Equal(t, page.Runs[0].LogEntryId, page.NextCursor)
+	_, next := get("/api/jobs/backup/runs?status=success&triggered_by=cron,ui&since=1h&min_duration=1s&limit=1&cursor=" + strconv.Itoa(page.NextCursor))
+	assert.Len(t, next.Runs, 1)
+	assert.Zero(t, next.NextCursor)
+	assert.True(t, next.Runs[0].TriggeredAt.Before(page.Runs[0].TriggeredAt))
+
+	_, page = get("/api/jobs/backup/runs?status=failed&status=timeout")
+	assert.Len(t, page.Runs, 1)
+
+	resp, _ = get("/api/jobs/nope/runs")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	for _, url := range []string{"/api/runs?status=broken", "/api/runs?sort=name", "/api/runs?min_duration=long", "/api/runs?cursor=next", "/api/jobs/backup/runs?since=yesterday"} {
+		resp, _ := get(url)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, url)
+	}
+}
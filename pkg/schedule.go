@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -12,40 +14,95 @@ import (
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog"
 )
 
+// reloadDebounce is the quiet period after a change to the schedule file
+// before it gets reloaded, editors tend to write files in multiple steps.
+const reloadDebounce = 500 * time.Millisecond
+
+// ConcurrencyGroup defines a named semaphore shared by the jobs that
+// reference it, at most Capacity of their runs execute at the same time.
+type ConcurrencyGroup struct {
+	Capacity int `yaml:"capacity" json:"capacity"`
+}
+
 // Schedule defines specs of a job schedule.
 type Schedule struct {
 	Jobs       map[string]*JobSpec `yaml:"jobs" json:"jobs"`
 	OnSuccess  OnEvent             `yaml:"on_success,omitempty" json:"on_success,omitempty"`
 	OnError    OnEvent             `yaml:"on_error,omitempty" json:"on_error,omitempty"`
+	OnTimeout  OnEvent             `yaml:"on_timeout,omitempty" json:"on_timeout,omitempty"`
 	TZLocation string              `yaml:"tz_location,omitempty" json:"tz_location,omitempty"`
-	loc        *time.Location
-	log        zerolog.Logger
-	cfg        Config
+	Timeout    time.Duration       `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	KillGrace  time.Duration       `yaml:"kill_grace,omitempty" json:"kill_grace,omitempty"`
+	// MaxParallelJobs limits the number of runs that execute at the same time
+	MaxParallelJobs   int                         `yaml:"max_parallel_jobs,omitempty" json:"max_parallel_jobs,omitempty"`
+	ConcurrencyGroups map[string]ConcurrencyGroup `yaml:"concurrency_groups,omitempty" json:"concurrency_groups,omitempty"`
+	Retention         Retention                   `yaml:"retention,omitempty" json:"retention,omitempty"`
+	CoreLogRetention  CoreLogRetention            `yaml:"core_log_retention,omitempty" json:"core_log_retention,omitempty"`
+	Auth              Auth                        `yaml:"auth,omitempty" json:"-"`
+	pool              *workerPool
+	groups            map[string]*workerPool
+	metrics           *metrics
+	loc               *time.Location
+	log               zerolog.Logger
+	cfg               Config
+	fn                string
+	// ctx and wg are those of the scheduler loop, for runs that are
+	// launched from outside of it to stop and be waited for along
+	ctx context.Context
+	wg  *sync.WaitGroup
+	// mu guards the fields that get swapped when the schedule is reloaded
+	mu sync.RWMutex
+	// active holds the runs that can be cancelled
+	active activeRuns
 }
 
+// Run runs the scheduler until cheek receives SIGINT or SIGTERM.
 func (s *Schedule) Run() {
-	var currentTickTime time.Time
-	s.log.Info().Msg("Scheduler started")
-	ticker := time.NewTicker(1 * time.Second)
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	if s.cfg.DB != nil {
-		defer func() { _ = s.cfg.DB.Close() }()
+	if s.cfg.Store != nil {
+		defer func() { _ = s.cfg.Store.Close() }()
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	s.run(ctx)
+}
 
-	go func() {
-		<-sigs
-		cancel()
-	}()
+// run runs the scheduler until ctx is done and the runs that are
+// in flight have finished.
+func (s *Schedule) run(ctx context.Context) {
+	var currentTickTime time.Time
+	s.log.Info().Msg("Scheduler started")
+	ticker := time.NewTicker(1 * time.Second)
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	defer signal.Stop(hups)
+
+	reloads := make(chan struct{}, 1)
+	if s.fn != "" {
+		if err := s.watchSchedule(ctx, reloads); err != nil {
+			s.log.Warn().Err(err).Msg("Cannot watch schedule file, reloading only on SIGHUP")
+		}
+	}
 
 	var wg sync.WaitGroup
+	s.mu.Lock()
+	s.ctx, s.wg = ctx, &wg
+	s.mu.Unlock()
+
+	s.catchUp(ctx, &wg)
+
+	if s.cfg.Store != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.housekeeping(ctx)
+		}()
+	}
 
 	for {
 		select {
@@ -68,23 +125,94 @@ func (s *Schedule) Run() {
 					wg.Add(1)
 					go func(j *JobSpec) {
 						defer wg.Done()
-						if j.DisableConcurrentExecution {
-							j.mutex.Lock()
-							defer j.mutex.Unlock()
-						}
-						j.execCommandWithRetryContext(ctx, "cron")
+						j.run(ctx, "cron")
 					}(j)
 				}
 			}
+			s.metrics.ticked(currentTickTime, s.Jobs)
+
+		case <-hups:
+			s.reloadOrKeep()
+
+		case <-reloads:
+			s.reloadOrKeep()
 
 		case <-ctx.Done():
 			s.log.Info().Msg("Shutting down scheduler due to context cancellation")
+			s.mu.Lock()
+			s.wg = nil
+			s.mu.Unlock()
 			wg.Wait()
 			return
 		}
 	}
 }
 
+// launch carries out a run that has been set up in the background, the
+// returned channel receives the run once it is done.
+func (s *Schedule) launch(j *JobSpec, jr JobRun) <-chan JobRun {
+	s.mu.RLock()
+	ctx, wg := s.ctx, s.wg
+	if wg != nil {
+		wg.Add(1)
+	}
+	s.mu.RUnlock()
+	// the scheduler loop is not running, e.g. when cheek is embedded
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	done := make(chan JobRun, 1)
+	go func() {
+		if wg != nil {
+			defer wg.Done()
+		}
+		done <- j.runSetUp(ctx, jr)
+	}()
+	return done
+}
+
+// catchUp launches runs for cron ticks that were missed while cheek was
+// not running, according to the misfire policy of each job.
+func (s *Schedule) catchUp(ctx context.Context, wg *sync.WaitGroup) {
+	if s.cfg.Store == nil {
+		s.log.Debug().Msg("No store configured, not checking for missed runs.")
+		return
+	}
+
+	now := s.now()
+	for _, j := range s.Jobs {
+		if j.MisfirePolicy == "" || j.MisfirePolicy == MisfireSkip {
+			continue
+		}
+
+		lastRun, err := s.cfg.Store.LastScheduledRun(j.Name)
+		if err != nil {
+			s.log.Warn().Str("job", j.Name).Err(err).Msg("Couldn't load last scheduled run.")
+			continue
+		}
+
+		ticks, err := j.missedTicks(lastRun, now)
+		if err != nil {
+			s.log.Warn().Str("job", j.Name).Err(err).Msg("Couldn't determine missed runs.")
+			continue
+		}
+		if len(ticks) == 0 {
+			continue
+		}
+
+		s.log.Info().Str("job", j.Name).Str("misfire_policy", j.MisfirePolicy).Times("missed_ticks", ticks).Msgf("Catching up on %d missed run(s)", len(ticks))
+
+		wg.Add(1)
+		go func(j *JobSpec, runs int) {
+			defer wg.Done()
+			for i := 0; i < runs && ctx.Err() == nil; i++ {
+				j.run(ctx, triggerCatchup)
+			}
+		}(j, len(ticks))
+	}
+}
+
 type stringArray []string
 
 func (a *stringArray) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -103,16 +231,35 @@ func (a *stringArray) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
-func readSpecs(fn string) (Schedule, error) {
+func readSpecs(fn string) (*Schedule, error) {
 	yfile, err := os.ReadFile(fn)
 	if err != nil {
-		return Schedule{}, err
+		return nil, err
 	}
 
-	specs := Schedule{}
+	specs := &Schedule{}
+
+	if err = yaml.Unmarshal(yfile, specs); err != nil {
+		return nil, err
+	}
 
-	if err = yaml.Unmarshal(yfile, &specs); err != nil {
-		return Schedule{}, err
+	// keep a canonical copy of each job's spec around,
+	// this allows to detect changes when reloading
+	var raw struct {
+		Jobs map[string]interface{} `yaml:"jobs"`
+	}
+	if err = yaml.Unmarshal(yfile, &raw); err != nil {
+		return nil, err
+	}
+	for k, v := range specs.Jobs {
+		if v == nil {
+			continue
+		}
+		spec, err := yaml.Marshal(raw.Jobs[k])
+		if err != nil {
+			return nil, err
+		}
+		v.spec = string(spec)
 	}
 
 	return specs, nil
@@ -131,13 +278,58 @@ func (s *Schedule) initialize() error {
 	}
 	s.loc = loc
 
+	if s.Timeout < 0 || s.KillGrace < 0 {
+		return fmt.Errorf("timeout and kill_grace cannot be negative")
+	}
+
+	if err := s.Retention.validate(); err != nil {
+		return err
+	}
+	if err := s.CoreLogRetention.validate(); err != nil {
+		return fmt.Errorf("core_log_retention: %w", err)
+	}
+
+	if err := s.Auth.validate(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+
+	if s.MaxParallelJobs < 0 {
+		return fmt.Errorf("max_parallel_jobs cannot be negative")
+	}
+	s.pool = newWorkerPool(s.MaxParallelJobs)
+
+	s.groups = make(map[string]*workerPool, len(s.ConcurrencyGroups))
+	for name, g := range s.ConcurrencyGroups {
+		if g.Capacity < 1 {
+			return fmt.Errorf("capacity of concurrency group '%s' should be at least 1", name)
+		}
+		s.groups[name] = newWorkerPool(g.Capacity)
+		s.groups[name].name = name
+	}
+
 	for k, v := range s.Jobs {
+		if v == nil {
+			return fmt.Errorf("job '%s' has an empty spec", k)
+		}
 		// check if trigger references exist
-		triggerJobs := append(v.OnSuccess.TriggerJob, v.OnError.TriggerJob...)
+		var triggerJobs []string
+		for _, e := range []OnEvent{v.OnSuccess, v.OnError, v.OnTimeout} {
+			triggerJobs = append(triggerJobs, e.TriggerJob...)
+		}
 		for _, t := range triggerJobs {
-			if _, ok := s.Jobs[t]; !ok {
+			tj, ok := s.Jobs[t]
+			if !ok {
 				return fmt.Errorf("cannot find spec of job '%s' that is referenced in job '%s'", t, k)
 			}
+			if tj != nil && !tj.defaultsSuffice() {
+				return fmt.Errorf("job '%s' that is referenced in job '%s' has required params without a default", t, k)
+			}
+		}
+		// check if concurrency group references exist
+		for _, g := range v.Groups {
+			if _, ok := s.ConcurrencyGroups[g]; !ok {
+				return fmt.Errorf("cannot find concurrency group '%s' that is referenced in job '%s'", g, k)
+			}
 		}
 		// set some metadata & refs for each job
 		// for easier retrievability
@@ -151,6 +343,40 @@ func (s *Schedule) initialize() error {
 			return err
 		}
 
+		// validate tz location, defaults to the schedule's
+		v.loc = s.loc
+		if v.TZLocation != "" {
+			loc, err := time.LoadLocation(v.TZLocation)
+			if err != nil {
+				return fmt.Errorf("tz_location '%s' for job '%s' not valid: %w", v.TZLocation, k, err)
+			}
+			v.loc = loc
+		}
+
+		if err := v.ValidateMisfirePolicy(); err != nil {
+			return err
+		}
+
+		if err := v.ValidateRetries(); err != nil {
+			return err
+		}
+
+		if err := v.ValidateParams(); err != nil {
+			return err
+		}
+
+		if err := v.ValidateConcurrencyPolicy(); err != nil {
+			return err
+		}
+
+		if v.Timeout < 0 || v.KillGrace < 0 {
+			return fmt.Errorf("timeout and kill_grace for job '%s' cannot be negative", k)
+		}
+
+		if err := v.Retention.validate(); err != nil {
+			return fmt.Errorf("retention of job '%s': %w", k, err)
+		}
+
 		// init nextTick
 		if err := v.setNextTick(s.now(), true); err != nil {
 			return err
@@ -162,20 +388,200 @@ func (s *Schedule) initialize() error {
 }
 
 func (s *Schedule) now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return time.Now().In(s.loc)
 }
 
-func loadSchedule(log zerolog.Logger, cfg Config, fn string) (Schedule, error) {
+// job returns the spec of a job in the currently active schedule.
+func (s *Schedule) job(name string) (*JobSpec, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	j, ok := s.Jobs[name]
+	return j, ok
+}
+
+// jobs returns the job specs of the currently active schedule. On reload
+// the map gets replaced rather than modified, so it is safe to range over.
+func (s *Schedule) jobs() map[string]*JobSpec {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Jobs
+}
+
+// group returns the semaphore of a concurrency group.
+func (s *Schedule) group(name string) (*workerPool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, ok := s.groups[name]
+	return g, ok
+}
+
+// events returns the schedule level event specs for a job run's exit status.
+func (s *Schedule) events(status int) []OnEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return eventsForStatus(status, s.OnSuccess, s.OnError, s.OnTimeout)
+}
+
+// auth returns the auth settings of the currently active schedule.
+func (s *Schedule) auth() Auth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Auth
+}
+
+// reload re-reads the schedule file and swaps in the new specs. Unchanged
+// jobs are kept as is, including runs that are in flight, and next ticks are
+// only recomputed for jobs of which the cron or effective timezone changed. If the new
+// specs fail to validate the current schedule is left untouched.
+func (s *Schedule) reload() error {
+	ns, err := readSpecs(s.fn)
+	if err != nil {
+		return err
+	}
+	ns.log = s.log
+	ns.cfg = s.cfg
+	ns.fn = s.fn
+
+	if err := ns.initialize(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added, changed, removed []string
+	jobs := make(map[string]*JobSpec, len(ns.Jobs))
+	for k, nj := range ns.Jobs {
+		oj, ok := s.Jobs[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case oj.spec == nj.spec && oj.loc.String() == nj.loc.String():
+			nj = oj
+		default:
+			changed = append(changed, k)
+			if oj.Cron == nj.Cron && oj.loc.String() == nj.loc.String() {
+				nj.nextTick = oj.nextTick
+			}
+			// share runtime state so concurrency policies keep
+			// applying to runs of the job from before the reload
+			nj.state = oj.runState()
+		}
+		nj.globalSchedule = s
+		jobs[k] = nj
+	}
+	for k := range s.Jobs {
+		if _, ok := jobs[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	s.Jobs = jobs
+	s.OnSuccess = ns.OnSuccess
+	s.OnError = ns.OnError
+	s.OnTimeout = ns.OnTimeout
+	s.Timeout = ns.Timeout
+	s.KillGrace = ns.KillGrace
+	s.TZLocation = ns.TZLocation
+	s.loc = ns.loc
+	s.MaxParallelJobs = ns.MaxParallelJobs
+	s.Retention = ns.Retention
+	s.CoreLogRetention = ns.CoreLogRetention
+	s.Auth = ns.Auth
+	s.pool.resize(ns.MaxParallelJobs)
+	// keep the semaphores of existing groups, runs might hold their slots
+	s.ConcurrencyGroups = ns.ConcurrencyGroups
+	groups := make(map[string]*workerPool, len(ns.groups))
+	for name, g := range ns.groups {
+		if og, ok := s.groups[name]; ok {
+			og.resize(ns.ConcurrencyGroups[name].Capacity)
+			g = og
+		}
+		groups[name] = g
+	}
+	s.groups = groups
+
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	s.log.Info().Strs("added", added).Strs("changed", changed).Strs("removed", removed).Msgf("Schedule reloaded: %d added, %d changed, %d removed", len(added), len(changed), len(removed))
+	return nil
+}
+
+func (s *Schedule) reloadOrKeep() {
+	if err := s.reload(); err != nil {
+		s.log.Error().Err(err).Msg("Schedule reload failed, keeping current schedule")
+	}
+}
+
+// watchSchedule watches the schedule file and signals on reloads when it
+// has changed.
+func (s *Schedule) watchSchedule(ctx context.Context, reloads chan<- struct{}) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// watch the directory instead of the file itself as editors
+	// often replace the file on save, which drops the watch
+	if err := w.Add(filepath.Dir(s.fn)); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	go func() {
+		defer func() { _ = w.Close() }()
+		var debounce <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) != s.fn || !(ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create)) {
+					continue
+				}
+				debounce = time.After(reloadDebounce)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				s.log.Warn().Err(err).Msg("Error watching schedule file")
+			case <-debounce:
+				debounce = nil
+				select {
+				case reloads <- struct{}{}:
+				default: // reload already pending
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func loadSchedule(log zerolog.Logger, cfg Config, fn string) (*Schedule, error) {
 	s, err := readSpecs(fn)
 	if err != nil {
-		return Schedule{}, err
+		return nil, err
 	}
 	s.log = log
+	if cfg.Store == nil {
+		log.Debug().Msg("No store configured, keeping job runs in memory.")
+		cfg.Store = NewMemoryStore()
+	}
 	s.cfg = cfg
+	s.metrics = newMetrics(s)
+	if s.fn, err = filepath.Abs(fn); err != nil {
+		return nil, err
+	}
 
 	// run validations
 	if err := s.initialize(); err != nil {
-		return Schedule{}, err
+		return nil, err
 	}
 	s.log.Info().Msg("Scheduled loaded and validated")
 	return s, nil
@@ -194,7 +600,31 @@ func RunSchedule(log zerolog.Logger, cfg Config, scheduleFn string) error {
 		s.log.Info().Msgf("Initializing (%v/%v) job: %s", i, numberJobs, k)
 		i++
 	}
-	go server(&s)
-	s.Run()
-	return nil
+	s.metrics.loadLastSuccess()
+
+	if s.cfg.Store != nil {
+		defer func() { _ = s.cfg.Store.Close() }()
+	}
+	srv, err := newServer(s)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	served := make(chan error, 1)
+	go func() {
+		err := srv.serve(ctx)
+		if err != nil {
+			s.log.Error().Err(err).Msg("HTTP server failed, shutting down")
+			cancel()
+		}
+		served <- err
+	}()
+
+	s.run(ctx)
+	return <-served
 }
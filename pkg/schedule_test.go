@@ -1,8 +1,11 @@
 package cheek
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -142,9 +145,9 @@ jobs:
 	// Collect job logs from individual jobs
 	var allJobLogs strings.Builder
 
-	// Access job runs that are stored in memory (without DB dependency)
+	// Access job runs from the in-memory store the schedule defaults to
 	for _, job := range s.Jobs {
-
+		job.loadRuns(100, true)
 		for _, run := range job.Runs {
 			spew.Dump(run)
 			allJobLogs.WriteString(run.Log)
@@ -165,3 +168,159 @@ jobs:
 	// because jobs can overlap (8 seconds runtime with 3-second jobs starting every second)
 	assert.Greater(t, concurrentStarts, 1, "Expected more than 1 start for concurrent job")
 }
+
+func writeSchedule(t *testing.T, fn string, spec string) {
+	t.Helper()
+	if err := os.WriteFile(fn, []byte(spec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduleReload(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, `
+jobs:
+  keep:
+    command: echo keep
+    cron: "* * * * *"
+  change:
+    command: echo change
+    cron: "* * * * *"
+  remove:
+    command: echo remove
+`)
+
+	b := new(tsBuffer)
+	s, err := loadSchedule(NewLogger("debug", nil, b), Config{}, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keep := s.Jobs["keep"]
+	changeTick := s.Jobs["change"].nextTick
+
+	writeSchedule(t, fn, `
+jobs:
+  keep:
+    command: echo keep
+    cron: "* * * * *"
+  change:
+    command: echo changed
+    cron: "0 0 1 1 *"
+  add:
+    command: echo add
+    on_success:
+      trigger_job:
+        - keep
+`)
+	assert.NoError(t, s.reload())
+
+	assert.Len(t, s.Jobs, 3)
+	assert.Same(t, keep, s.Jobs["keep"], "unchanged job should be kept as is")
+	assert.Equal(t, stringArray{"echo", "changed"}, s.Jobs["change"].Command)
+	assert.NotEqual(t, changeTick, s.Jobs["change"].nextTick, "next tick should be recomputed for changed cron")
+	assert.Same(t, s, s.Jobs["add"].globalSchedule)
+	assert.NotContains(t, s.Jobs, "remove")
+	assert.Contains(t, b.String(), `"added":["add"],"changed":["change"],"removed":["remove"]`)
+
+	// invalid specs should keep the current schedule
+	writeSchedule(t, fn, `
+jobs:
+  keep:
+    command: echo keep
+    cron: "not a cron"
+`)
+	assert.Error(t, s.reload())
+	assert.Len(t, s.Jobs, 3)
+
+	writeSchedule(t, fn, "jobs: [")
+	assert.Error(t, s.reload())
+	assert.Len(t, s.Jobs, 3)
+}
+
+func TestScheduleReloadKeepsNextTick(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, `
+jobs:
+  foo:
+    command: echo foo
+    cron: "0 0 1 1 *"
+`)
+	s, err := loadSchedule(zerolog.Nop(), Config{}, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tick := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Jobs["foo"].nextTick = tick
+
+	// changing the command only should not touch the next tick
+	writeSchedule(t, fn, `
+jobs:
+  foo:
+    command: echo bar
+    cron: "0 0 1 1 *"
+`)
+	assert.NoError(t, s.reload())
+	assert.Equal(t, tick, s.Jobs["foo"].nextTick)
+}
+
+func TestWatchSchedule(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "schedule.yaml")
+	writeSchedule(t, fn, "jobs: {}")
+
+	s, err := loadSchedule(zerolog.Nop(), Config{}, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloads := make(chan struct{}, 1)
+	assert.NoError(t, s.watchSchedule(ctx, reloads))
+
+	writeSchedule(t, fn, "jobs: {}\n")
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a reload after changing the schedule file")
+	}
+}
+
+func TestScheduleCatchUp(t *testing.T) {
+	db := setupTestDB(t)
+	defer func() { _ = db.Close() }()
+
+	s := Schedule{
+		Jobs: map[string]*JobSpec{
+			"nightly": {
+				Cron:          "0 2 * * *",
+				Command:       []string{"echo", "nightly"},
+				MisfirePolicy: MisfireRunAll,
+			},
+			"skipped": {
+				Cron:    "0 2 * * *",
+				Command: []string{"echo", "skipped"},
+			},
+		},
+		log: zerolog.Nop(),
+		cfg: Config{Store: NewSQLiteStore(db), SuppressLogs: true},
+	}
+	if err := s.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// pretend both jobs last ran three days ago
+	for name := range s.Jobs {
+		jr := &JobRun{Name: name, TriggeredAt: s.now().Add(-72 * time.Hour), TriggeredBy: "cron"}
+		assert.NoError(t, InsertOrUpdateJobRun(db, jr))
+	}
+
+	var wg sync.WaitGroup
+	s.catchUp(context.Background(), &wg)
+	wg.Wait()
+
+	var count int
+	assert.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM log WHERE job = ? AND triggered_by = ?", "nightly", triggerCatchup))
+	assert.Equal(t, 3, count, "Should catch up on the three missed nightly runs")
+	assert.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM log WHERE job = ? AND triggered_by = ?", "skipped", triggerCatchup))
+	assert.Equal(t, 0, count, "Should not catch up without a misfire policy")
+}
@@ -0,0 +1,230 @@
+package cheek
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// defaultSearchLimit is the number of runs returned if no limit is given.
+	defaultSearchLimit = 50
+	// maxSearchLimit is the maximum number of runs returned at once.
+	maxSearchLimit = 500
+	// snippetTokens is the number of words in a snippet.
+	snippetTokens = 16
+	// snippetChars is the number of characters around the first
+	// match in a snippet, for stores that don't count words.
+	snippetChars = 60
+
+	// matchStart and matchEnd mark matches in raw snippets.
+	matchStart = "\x02"
+	matchEnd   = "\x03"
+)
+
+// SearchQuery searches the output of runs, all of its words have to appear.
+type SearchQuery struct {
+	Query string
+	Job   string
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+// SearchResult is a run of which the output matches a search.
+type SearchResult struct {
+	ID          int       `json:"id" db:"id"`
+	Job         string    `json:"job" db:"job"`
+	TriggeredAt time.Time `json:"triggered_at" db:"triggered_at"`
+	TriggeredBy string    `json:"triggered_by" db:"triggered_by"`
+	Status      *int      `json:"status,omitempty" db:"status"`
+	// Snippet is the part of the output with the matches, as HTML
+	// in which the matches are wrapped in <mark> elements
+	Snippet string `json:"snippet" db:"snippet"`
+}
+
+func (q SearchQuery) terms() []string {
+	return strings.Fields(q.Query)
+}
+
+func (q SearchQuery) limit() int {
+	if q.Limit <= 0 {
+		return defaultSearchLimit
+	}
+	return min(q.Limit, maxSearchLimit)
+}
+
+func (q SearchQuery) validate() error {
+	if len(q.terms()) == 0 {
+		return errors.New("nothing to search for")
+	}
+	return nil
+}
+
+// filters returns the conditions on the runs in log l other than the words.
+func (q SearchQuery) filters() (string, []any) {
+	var where string
+	var args []any
+	if q.Job != "" {
+		where += " AND l.job = ?"
+		args = append(args, q.Job)
+	}
+	if !q.Since.IsZero() {
+		where += " AND julianday(l.triggered_at) >= julianday(?)"
+		args = append(args, q.Since.UTC().Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		where += " AND julianday(l.triggered_at) <= julianday(?)"
+		args = append(args, q.Until.UTC().Format(time.RFC3339Nano))
+	}
+	return where, args
+}
+
+// ftsQuery turns the words of the query into phrases, so characters
+// that have a meaning in the fts5 query syntax are searched for as is.
+func (q SearchQuery) ftsQuery() string {
+	var phrases []string
+	for _, t := range q.terms() {
+		phrases = append(phrases, `"`+strings.ReplaceAll(t, `"`, `""`)+`"`)
+	}
+	return strings.Join(phrases, " ")
+}
+
+// highlight turns a raw snippet into HTML, with the marked matches in <mark> elements.
+func highlight(raw string) string {
+	s := html.EscapeString(raw)
+	s = strings.ReplaceAll(s, matchStart, "<mark>")
+	return strings.ReplaceAll(s, matchEnd, "</mark>")
+}
+
+// SearchRuns searches the output of runs, most recent runs first. The
+// index covers the output of runs that are done, runs that are executing
+// only have their output in log_lines so far and are searched there.
+func SearchRuns(db *sqlx.DB, q SearchQuery) ([]SearchResult, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	filters, filterArgs := q.filters()
+
+	query := fmt.Sprintf(`
+		SELECT l.id, l.job, l.triggered_at, COALESCE(l.triggered_by, '') AS triggered_by, l.status,
+			snippet(log_search, 0, '%s', '%s', '…', %d) AS snippet
+		FROM log_search
+		JOIN log l ON l.id = log_search.rowid
+		WHERE log_search MATCH ? AND COALESCE(l.is_running, 0) = 0`, matchStart, matchEnd, snippetTokens)
+	query += filters + " ORDER BY l.triggered_at DESC, l.id DESC LIMIT ?"
+	args := append(append([]any{q.ftsQuery()}, filterArgs...), q.limit())
+
+	results := []SearchResult{}
+	if err := db.Select(&results, query, args...); err != nil {
+		return nil, fmt.Errorf("search runs: %w", err)
+	}
+	for i := range results {
+		results[i].Snippet = highlight(results[i].Snippet)
+	}
+
+	running, err := searchRunning(db, q, filters, filterArgs)
+	if err != nil || len(running) == 0 {
+		return results, err
+	}
+	results = append(results, running...)
+	sort.SliceStable(results, func(a, b int) bool {
+		if !results[a].TriggeredAt.Equal(results[b].TriggeredAt) {
+			return results[a].TriggeredAt.After(results[b].TriggeredAt)
+		}
+		return results[a].ID > results[b].ID
+	})
+	return results[:min(len(results), q.limit())], nil
+}
+
+// searchRunning searches the output that the runs which are executing
+// have written so far.
+func searchRunning(db *sqlx.DB, q SearchQuery, filters string, args []any) ([]SearchResult, error) {
+	var runs []SearchResult
+	query := `
+		SELECT l.id, l.job, l.triggered_at, COALESCE(l.triggered_by, '') AS triggered_by, l.status,
+			COALESCE((
+				SELECT group_concat(content, char(10))
+				FROM (SELECT content FROM log_lines WHERE job_run_id = l.id ORDER BY line_number)
+			), '') AS snippet
+		FROM log l
+		WHERE l.is_running = 1` + filters
+	if err := db.Select(&runs, query, args...); err != nil {
+		return nil, fmt.Errorf("search running runs: %w", err)
+	}
+
+	results := []SearchResult{}
+	for _, r := range runs {
+		snippet, ok := matchSnippet(r.Snippet, q.terms())
+		if !ok {
+			continue
+		}
+		r.Snippet = highlight(snippet)
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// matchSnippet returns a raw snippet around the first match of the terms in
+// text, or false if not all terms appear in the text.
+func matchSnippet(text string, terms []string) (string, bool) {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// lowering changed the length of some characters, which
+		// would throw off the positions of the matches
+		lower = text
+	}
+	first := -1
+	for _, t := range terms {
+		i := strings.Index(lower, strings.ToLower(t))
+		if i < 0 {
+			return "", false
+		}
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+
+	start, end := max(0, first-snippetChars), min(len(text), first+snippetChars)
+	// don't cut runes in half
+	for start > 0 && start < len(text) && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	window, lowerWindow := text[start:end], lower[start:end]
+	for i := 0; i < len(window); {
+		matched := false
+		for _, t := range terms {
+			if t = strings.ToLower(t); strings.HasPrefix(lowerWindow[i:], t) {
+				b.WriteString(matchStart + window[i:i+len(t)] + matchEnd)
+				i += len(t)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			b.WriteByte(window[i])
+			i++
+		}
+	}
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
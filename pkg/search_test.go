@@ -0,0 +1,137 @@
+package cheek
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchRuns(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			ok, failed := StatusOK, StatusError
+			runs := []*JobRun{
+				{Name: "backup", TriggeredAt: now.Add(-10 * 24 * time.Hour), TriggeredBy: "cron", Status: &failed, Log: "dial tcp: connection refused"},
+				{Name: "backup", TriggeredAt: now.Add(-2 * time.Hour), TriggeredBy: "cron", Status: &failed, Log: "starting backup\ndial tcp 10.0.0.1:5432: Connection refused <retrying>"},
+				{Name: "report", TriggeredAt: now.Add(-time.Hour), TriggeredBy: "ui", Status: &ok, Log: "connection established, report sent"},
+			}
+			for _, jr := range runs {
+				assert.NoError(t, store.SaveJobRun(jr))
+			}
+
+			ids := func(q SearchQuery) []int {
+				results, err := store.Search(q)
+				assert.NoError(t, err)
+				var ids []int
+				for _, r := range results {
+					ids = append(ids, r.ID)
+				}
+				return ids
+			}
+
+			assert.Equal(t, []int{runs[1].LogEntryId, runs[0].LogEntryId}, ids(SearchQuery{Query: "connection refused"}))
+			assert.Equal(t, []int{runs[2].LogEntryId, runs[1].LogEntryId, runs[0].LogEntryId}, ids(SearchQuery{Query: "connection"}))
+			assert.Equal(t, []int{runs[1].LogEntryId}, ids(SearchQuery{Query: "connection refused", Since: now.Add(-7 * 24 * time.Hour)}))
+			assert.Equal(t, []int{runs[0].LogEntryId}, ids(SearchQuery{Query: "refused", Until: now.Add(-7 * 24 * time.Hour)}))
+			assert.Equal(t, []int{runs[2].LogEntryId}, ids(SearchQuery{Query: "connection", Job: "report"}))
+			assert.Equal(t, []int{runs[1].LogEntryId}, ids(SearchQuery{Query: "connection", Limit: 2, Job: "backup", Since: now.Add(-3 * time.Hour)}))
+			// characters of the fts5 query syntax are searched for as is
+			assert.Equal(t, []int{runs[1].LogEntryId}, ids(SearchQuery{Query: "10.0.0.1:5432"}))
+			assert.Empty(t, ids(SearchQuery{Query: "timeout"}))
+
+			// runs that get updated or pruned are kept up to date in the index
+			runs[2].Log = "timeout"
+			assert.NoError(t, store.SaveJobRun(runs[2]))
+			assert.Equal(t, []int{runs[2].LogEntryId}, ids(SearchQuery{Query: "timeout"}))
+			_, err := store.PruneJobRuns("backup", Retention{KeepDays: 7}, now)
+			assert.NoError(t, err)
+			assert.Equal(t, []int{runs[1].LogEntryId}, ids(SearchQuery{Query: "refused"}))
+
+			results, err := store.Search(SearchQuery{Query: "refused"})
+			assert.NoError(t, err)
+			assert.Equal(t, "backup", results[0].Job)
+			assert.Equal(t, StatusError, *results[0].Status)
+			assert.Contains(t, results[0].Snippet, "<mark>refused</mark> &lt;retrying&gt;")
+
+			_, err = store.Search(SearchQuery{Query: "  "})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSearchRunningRuns(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			jr := &JobRun{Name: "backup", TriggeredAt: time.Now().UTC().Truncate(time.Second), TriggeredBy: "cron"}
+			assert.NoError(t, store.SaveJobRun(jr))
+			assert.NoError(t, store.AppendLogLines([]LogLine{
+				{JobRunID: jr.LogEntryId, LineNumber: 2, Content: "dial tcp: connection refused", Stream: StreamStderr},
+				{JobRunID: jr.LogEntryId, LineNumber: 1, Content: "starting backup", Stream: StreamStdout},
+			}))
+
+			// the output written so far is searched, across lines
+			for _, query := range []string{"connection refused", "backup refused"} {
+				results, err := store.Search(SearchQuery{Query: query})
+				assert.NoError(t, err)
+				if assert.Len(t, results, 1, query) {
+					assert.Equal(t, jr.LogEntryId, results[0].ID)
+					assert.Nil(t, results[0].Status)
+					assert.Contains(t, results[0].Snippet, "<mark>refused</mark>")
+				}
+			}
+			results, err := store.Search(SearchQuery{Query: "connection", Job: "other"})
+			assert.NoError(t, err)
+			assert.Empty(t, results)
+
+			// once done, the run is found once
+			failed := StatusError
+			jr.Status, jr.Log = &failed, "starting backup\ndial tcp: connection refused"
+			assert.NoError(t, store.SaveJobRun(jr))
+			results, err = store.Search(SearchQuery{Query: "connection refused"})
+			assert.NoError(t, err)
+			assert.Len(t, results, 1)
+		})
+	}
+}
+
+func TestMatchSnippet(t *testing.T) {
+	snippet, ok := matchSnippet("Error: Connection refused", []string{"connection", "error"})
+	assert.True(t, ok)
+	assert.Equal(t, "<mark>Error</mark>: <mark>Connection</mark> refused", highlight(snippet))
+
+	_, ok = matchSnippet("Error: Connection refused", []string{"connection", "timeout"})
+	assert.False(t, ok)
+}
+
+func TestSearchAPI(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	s := &Schedule{Jobs: map[string]*JobSpec{}, cfg: cfg, log: zerolog.Nop()}
+
+	status := StatusError
+	assert.NoError(t, cfg.Store.SaveJobRun(&JobRun{Name: "backup", TriggeredAt: time.Now(), TriggeredBy: "cron", Status: &status, Log: "connection refused"}))
+
+	get := func(url string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		setupRouter(s).ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := get("/api/search?q=refused&job=backup&since=7d")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var results []SearchResult
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &results))
+	assert.Len(t, results, 1)
+	assert.Equal(t, "connection <mark>refused</mark>", results[0].Snippet)
+
+	assert.Equal(t, http.StatusBadRequest, get("/api/search").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/api/search?q=refused&since=last+week").Code)
+	assert.Equal(t, http.StatusOK, get("/search?q=refused").Code)
+}
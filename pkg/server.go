@@ -0,0 +1,202 @@
+package cheek
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultSocketMode leaves the socket to the user and group cheek runs as.
+	defaultSocketMode = "0660"
+	// shutdownTimeout is how long requests in flight get to finish when
+	// cheek stops.
+	shutdownTimeout = 5 * time.Second
+)
+
+// httpServer serves the web UI and API.
+type httpServer struct {
+	s     *Schedule
+	srv   *http.Server
+	ln    net.Listener
+	certs *certReloader
+}
+
+// newServer sets up the HTTP server of a schedule and starts listening,
+// so that a port in use or a broken certificate is reported right away.
+func newServer(s *Schedule) (*httpServer, error) {
+	cfg := s.cfg
+	h := &httpServer{s: s, srv: &http.Server{Handler: setupRouter(s)}}
+
+	var tlsConfig *tls.Config
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		if cfg.TLSCert == "" || cfg.TLSKey == "" {
+			return nil, fmt.Errorf("both a TLS certificate and key are needed")
+		}
+		certs, err := newCertReloader(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		h.certs = certs
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.getCertificate}
+	}
+	if cfg.TLSClientCA != "" {
+		if tlsConfig == nil {
+			return nil, fmt.Errorf("verifying client certificates needs a TLS certificate and key")
+		}
+		pool, err := loadCertPool(cfg.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	var err error
+	var addr string
+	if cfg.Socket != "" {
+		h.ln, err = listenSocket(cfg.Socket, cfg.SocketMode)
+		addr = "unix:" + cfg.Socket
+	} else {
+		addr = net.JoinHostPort(cfg.Bind, cfg.Port)
+		h.ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", addr, err)
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		h.ln = tls.NewListener(h.ln, tlsConfig)
+		scheme = "https"
+	}
+	s.log.Info().Msgf("Starting HTTP server on %s://%s", scheme, h.ln.Addr())
+	return h, nil
+}
+
+// serve serves requests until ctx is done, then shuts the server down
+// gracefully. Certificates are reloaded on SIGHUP.
+func (h *httpServer) serve(ctx context.Context) error {
+	// requests share the context, which ends streams on shutdown
+	h.srv.BaseContext = func(net.Listener) context.Context { return ctx }
+
+	if h.certs != nil {
+		hups := make(chan os.Signal, 1)
+		signal.Notify(hups, syscall.SIGHUP)
+		defer signal.Stop(hups)
+		go func() {
+			for {
+				select {
+				case <-hups:
+					if err := h.certs.reload(); err != nil {
+						h.s.log.Error().Err(err).Msg("TLS certificate reload failed, keeping current certificate")
+						continue
+					}
+					h.s.log.Info().Msg("TLS certificate reloaded")
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdown <- h.srv.Shutdown(sctx)
+	}()
+
+	if err := h.srv.Serve(h.ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	if err := <-shutdown; err != nil {
+		return fmt.Errorf("shut down HTTP server: %w", err)
+	}
+	h.s.log.Info().Msg("HTTP server stopped")
+	return nil
+}
+
+// listenSocket listens on a Unix domain socket, replacing the socket a
+// previous run of cheek might have left behind.
+func listenSocket(path string, mode string) (net.Listener, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("socket mode '%s' is not an octal file mode", mode)
+	}
+
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func loadCertPool(fn string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", fn)
+	}
+	return pool, nil
+}
+
+// certReloader holds a TLS certificate that can be swapped while the
+// server is running, when a renewed certificate has been written.
+type certReloader struct {
+	certFile, keyFile string
+	mu                sync.RWMutex
+	cert              *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
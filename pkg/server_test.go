@@ -0,0 +1,189 @@
+package cheek
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert          *x509.Certificate
+	key           *ecdsa.PrivateKey
+	certFn, keyFn string
+}
+
+// writeCert writes a certificate for 127.0.0.1, signed by parent or
+// self-signed if parent is nil.
+func writeCert(t *testing.T, dir, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	tc := &testCert{cert: cert, key: key, certFn: filepath.Join(dir, name+".pem"), keyFn: filepath.Join(dir, name+"-key.pem")}
+	assert.NoError(t, os.WriteFile(tc.certFn, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(tc.keyFn, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return tc
+}
+
+// startServer serves a schedule without jobs until the test is done.
+func startServer(t *testing.T, cfg Config) *httpServer {
+	s := &Schedule{Jobs: map[string]*JobSpec{}, cfg: cfg, log: zerolog.Nop()}
+	h, err := newServer(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- h.serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-served)
+	})
+	return h
+}
+
+func TestServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := writeCert(t, dir, "ca", nil)
+	server := writeCert(t, dir, "server", ca)
+	client := writeCert(t, dir, "client", ca)
+
+	cfg := NewConfig()
+	cfg.Bind, cfg.Port = "127.0.0.1", "0"
+	cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA = server.certFn, server.keyFn, ca.certFn
+	h := startServer(t, cfg)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		return c.Get("https://" + h.ln.Addr().String() + "/healthz/")
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(client.certFn, client.keyFn)
+	assert.NoError(t, err)
+	resp, err := get(clientCert)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, server.cert.SerialNumber, resp.TLS.PeerCertificates[0].SerialNumber)
+		_ = resp.Body.Close()
+	}
+
+	// no client certificate
+	_, err = get()
+	assert.Error(t, err)
+
+	// a renewed certificate is picked up on reload
+	renewed := writeCert(t, dir, "server", ca)
+	assert.NoError(t, h.certs.reload())
+	resp, err = get(clientCert)
+	if assert.NoError(t, err) {
+		assert.Equal(t, renewed.cert.SerialNumber, resp.TLS.PeerCertificates[0].SerialNumber)
+		_ = resp.Body.Close()
+	}
+
+	// a broken certificate keeps the current one
+	assert.NoError(t, os.WriteFile(server.certFn, []byte("broken"), 0o600))
+	assert.Error(t, h.certs.reload())
+	resp, err = get(clientCert)
+	if assert.NoError(t, err) {
+		assert.Equal(t, renewed.cert.SerialNumber, resp.TLS.PeerCertificates[0].SerialNumber)
+		_ = resp.Body.Close()
+	}
+}
+
+func TestServerSocket(t *testing.T) {
+	// socket paths are limited in length, keep it short
+	dir, err := os.MkdirTemp("", "cheek")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	fn := filepath.Join(dir, "cheek.sock")
+
+	// a socket left behind gets replaced
+	stale, err := net.Listen("unix", fn)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	cfg := NewConfig()
+	cfg.Socket, cfg.SocketMode = fn, "0600"
+	t.Run("serve", func(t *testing.T) {
+		startServer(t, cfg)
+
+		fi, err := os.Stat(fn)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+		c := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", fn)
+		}}}
+		resp, err := c.Get("http://cheek/healthz/")
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			_ = resp.Body.Close()
+		}
+	})
+
+	// the socket is removed on shutdown
+	_, err = os.Stat(fn)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, os.WriteFile(fn, nil, 0o600))
+	_, err = newServer(&Schedule{cfg: cfg, log: zerolog.Nop()})
+	assert.ErrorContains(t, err, "is not a socket")
+}
+
+func TestServerConfig(t *testing.T) {
+	for name, tc := range map[string]struct {
+		edit func(cfg *Config)
+		err  string
+	}{
+		"cert without key": {func(cfg *Config) { cfg.TLSCert = "cert.pem" }, "both a TLS certificate and key are needed"},
+		"client ca only":   {func(cfg *Config) { cfg.TLSClientCA = "ca.pem" }, "needs a TLS certificate and key"},
+		"missing cert":     {func(cfg *Config) { cfg.TLSCert, cfg.TLSKey = "nope.pem", "nope.pem" }, "load TLS certificate"},
+		"socket mode":      {func(cfg *Config) { cfg.Socket, cfg.SocketMode = "cheek.sock", "rw" }, "not an octal file mode"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := NewConfig()
+			tc.edit(&cfg)
+			_, err := newServer(&Schedule{cfg: cfg, log: zerolog.Nop()})
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
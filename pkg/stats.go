@@ -0,0 +1,109 @@
+package cheek
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// defaultStatsWindow is the period stats cover if no window is given.
+const defaultStatsWindow = "7d"
+
+// RunStats summarizes finished job runs. Durations are
+// in milliseconds, like the durations of runs. The counts and durations
+// cover the runs in the window, when the last success and failure happened
+// and the failure streak look at all runs.
+type RunStats struct {
+	Runs      int `json:"runs"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	TimedOut  int `json:"timed_out"`
+	Skipped   int `json:"skipped"`
+	Cancelled int `json:"cancelled"`
+	// SuccessRate is the share of the runs that succeeded, skipped and
+	// cancelled runs left aside, or 0 if there are none
+	SuccessRate  float64       `json:"success_rate"`
+	MeanDuration time.Duration `json:"mean_duration"`
+	P50Duration  time.Duration `json:"p50_duration"`
+	P95Duration  time.Duration `json:"p95_duration"`
+	MaxDuration  time.Duration `json:"max_duration"`
+	LastSuccess  *time.Time    `json:"last_success,omitempty"`
+	LastFailure  *time.Time    `json:"last_failure,omitempty"`
+	// FailureStreak is the number of runs that failed or timed out
+	// since the last successful run. It is left out of the stats of
+	// all jobs together, where the runs of different jobs interleave.
+	FailureStreak int `json:"failure_streak"`
+}
+
+// setHistory takes when the last success and failure happened and the
+// failure streak from the stats of all runs.
+func (st *RunStats) setHistory(jobName string, all RunStats) {
+	st.LastSuccess, st.LastFailure = all.LastSuccess, all.LastFailure
+	st.FailureStreak = 0
+	if jobName != "" {
+		st.FailureStreak = all.FailureStreak
+	}
+}
+
+// summarize computes the stats of finished runs, oldest first.
+func summarize(jrs []JobRun) RunStats {
+	var st RunStats
+	var durations []time.Duration
+	for _, jr := range jrs {
+		if jr.Status == nil {
+			continue
+		}
+		st.Runs++
+		at := jr.TriggeredAt
+		switch *jr.Status {
+		case StatusOK:
+			st.Succeeded++
+			st.LastSuccess = latest(st.LastSuccess, at)
+			st.FailureStreak = 0
+		case StatusSkipped:
+			st.Skipped++
+			continue
+		case StatusCancelled:
+			st.Cancelled++
+			continue
+		case StatusTimeout:
+			st.TimedOut++
+			st.LastFailure = latest(st.LastFailure, at)
+			st.FailureStreak++
+		default:
+			st.Failed++
+			st.LastFailure = latest(st.LastFailure, at)
+			st.FailureStreak++
+		}
+		durations = append(durations, jr.Duration)
+	}
+
+	if len(durations) == 0 {
+		return st
+	}
+	st.SuccessRate = float64(st.Succeeded) / float64(len(durations))
+
+	sort.Slice(durations, func(a, b int) bool { return durations[a] < durations[b] })
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	st.MeanDuration = total / time.Duration(len(durations))
+	st.P50Duration = percentile(durations, 50)
+	st.P95Duration = percentile(durations, 95)
+	st.MaxDuration = durations[len(durations)-1]
+	return st
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func latest(t *time.Time, at time.Time) *time.Time {
+	if t == nil || at.After(*t) {
+		return &at
+	}
+	return t
+}
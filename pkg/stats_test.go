@@ -0,0 +1,149 @@
+package cheek
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarize(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	var jrs []JobRun
+	for i, status := range []int{StatusOK, StatusOK, 1, StatusOK, StatusSkipped, StatusError, StatusTimeout, StatusSkipped} {
+		jrs = append(jrs, JobRun{TriggeredAt: start.Add(time.Duration(i) * time.Hour), Status: &status, Duration: time.Duration((i + 1) * 100)})
+	}
+	jrs = append(jrs, JobRun{TriggeredAt: start.Add(24 * time.Hour)}) // still running
+
+	st := summarize(jrs)
+	assert.Equal(t, 8, st.Runs)
+	assert.Equal(t, 3, st.Succeeded)
+	assert.Equal(t, 2, st.Failed)
+	assert.Equal(t, 1, st.TimedOut)
+	assert.Equal(t, 2, st.Skipped)
+	assert.Equal(t, 0.5, st.SuccessRate)
+	// durations of the runs that weren't skipped: 100, 200, 300, 400, 600, 700
+	assert.Equal(t, time.Duration(383), st.MeanDuration)
+	assert.Equal(t, time.Duration(300), st.P50Duration)
+	assert.Equal(t, time.Duration(700), st.P95Duration)
+	assert.Equal(t, time.Duration(700), st.MaxDuration)
+	assert.Equal(t, start.Add(3*time.Hour), *st.LastSuccess)
+	assert.Equal(t, start.Add(6*time.Hour), *st.LastFailure)
+	assert.Equal(t, 2, st.FailureStreak)
+
+	assert.Equal(t, RunStats{}, summarize(nil))
+}
+
+func TestStoreStats(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC()
+			for i, status := range []int{1, StatusOK, 1, 1} {
+				jr := &JobRun{Name: "backup", TriggeredAt: now.Add(time.Duration(i-4) * time.Hour), TriggeredBy: "cron", Status: &status, Duration: 1000}
+				assert.NoError(t, store.SaveJobRun(jr))
+			}
+			old := StatusOK
+			assert.NoError(t, store.SaveJobRun(&JobRun{Name: "backup", TriggeredAt: now.Add(-30 * 24 * time.Hour), TriggeredBy: "cron", Status: &old}))
+			assert.NoError(t, store.SaveJobRun(&JobRun{Name: "report", TriggeredAt: now, TriggeredBy: "cron", Status: &old}))
+
+			st, err := store.Stats("backup", now.Add(-7*24*time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, 4, st.Runs)
+			assert.Equal(t, 0.25, st.SuccessRate)
+			assert.Equal(t, 2, st.FailureStreak)
+			assert.Equal(t, time.Duration(1000), st.P95Duration)
+
+			st, err = store.Stats("", now.Add(-7*24*time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, 5, st.Runs)
+			assert.Equal(t, 0, st.FailureStreak)
+		})
+	}
+}
+
+func TestStoreStatsHistory(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			// the last success and most failures are from before the window
+			for _, r := range []struct {
+				ago    time.Duration
+				status int
+			}{{12 * 24 * time.Hour, 1}, {10 * 24 * time.Hour, StatusOK}, {9 * 24 * time.Hour, 1}, {8 * 24 * time.Hour, StatusSkipped}, {2 * time.Hour, StatusTimeout}, {time.Hour, 1}} {
+				status := r.status
+				assert.NoError(t, store.SaveJobRun(&JobRun{Name: "flaky", TriggeredAt: now.Add(-r.ago), TriggeredBy: "cron", Status: &status}))
+			}
+			ok := StatusOK
+			assert.NoError(t, store.SaveJobRun(&JobRun{Name: "other", TriggeredAt: now.Add(-30 * time.Minute), TriggeredBy: "cron", Status: &ok}))
+
+			st, err := store.Stats("flaky", now.Add(-7*24*time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, 2, st.Runs)
+			assert.Equal(t, 3, st.FailureStreak)
+			if assert.NotNil(t, st.LastSuccess) {
+				assert.True(t, now.Add(-10*24*time.Hour).Equal(*st.LastSuccess))
+			}
+			if assert.NotNil(t, st.LastFailure) {
+				assert.True(t, now.Add(-time.Hour).Equal(*st.LastFailure))
+			}
+
+			// the streak means nothing across jobs
+			st, err = store.Stats("", now.Add(-7*24*time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, 3, st.Runs)
+			assert.Equal(t, 0, st.FailureStreak)
+			if assert.NotNil(t, st.LastSuccess) {
+				assert.True(t, now.Add(-30*time.Minute).Equal(*st.LastSuccess))
+			}
+		})
+	}
+}
+
+func TestStatsAPI(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Store = NewMemoryStore()
+	s := &Schedule{Jobs: map[string]*JobSpec{"backup": {Name: "backup", cfg: cfg}, "report": {Name: "report", cfg: cfg}}, cfg: cfg, log: zerolog.Nop()}
+
+	now := time.Now()
+	for i, status := range []int{StatusOK, 1} {
+		assert.NoError(t, cfg.Store.SaveJobRun(&JobRun{Name: "backup", TriggeredAt: now.Add(time.Duration(-i) * 24 * time.Hour), TriggeredBy: "cron", Status: &status, Duration: 1000}))
+	}
+
+	get := func(url string) (*httptest.ResponseRecorder, StatsResponse) {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		setupRouter(s).ServeHTTP(resp, req)
+		var sr StatsResponse
+		if resp.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &sr))
+		}
+		return resp, sr
+	}
+
+	resp, sr := get("/api/jobs/backup/stats")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "backup", sr.Job)
+	assert.Equal(t, "7d", sr.Window)
+	assert.Equal(t, 2, sr.Runs)
+	assert.Equal(t, 0.5, sr.SuccessRate)
+	assert.Equal(t, time.Duration(1000), sr.MeanDuration)
+
+	_, sr = get("/api/jobs/backup/stats?window=12h")
+	assert.Equal(t, 1, sr.Runs)
+	assert.Equal(t, 1.0, sr.SuccessRate)
+
+	resp, sr = get("/api/stats?window=30d")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, 2, sr.Runs)
+	assert.Equal(t, 2, sr.Jobs["backup"].Runs)
+	assert.Equal(t, 0, sr.Jobs["report"].Runs)
+
+	resp, _ = get("/api/jobs/nope/stats")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	resp, _ = get("/api/stats?window=a+while")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
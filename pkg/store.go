@@ -0,0 +1,383 @@
+package cheek
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	StoreSQLite = "sqlite"
+	StoreMemory = "memory"
+)
+
+// ErrJobRunNotFound is returned by stores for job runs they don't know about.
+var ErrJobRunNotFound = errors.New("job run not found")
+
+// Store persists job runs, their output and the core logs of cheek.
+type Store interface {
+	// SaveJobRun inserts a job run or updates it if it was saved before,
+	// the run gets the id it was stored under.
+	SaveJobRun(jr *JobRun) error
+	// AppendLogLines stores output lines of job runs.
+	AppendLogLines(lines []LogLine) error
+	// LogLines returns the output lines of a job run after a line number.
+	LogLines(jobRunID int, afterLineNumber int) ([]LogLine, error)
+	// JobRun returns a job run by id, or the latest run of the job if id is -1.
+	JobRun(jobName string, id int) (JobRun, error)
+	// JobRuns returns the latest runs of a job, newest first.
+	JobRuns(jobName string, nruns int, includeLogs bool) ([]JobRun, error)
+	// LastScheduledRun returns when a job was last triggered by the scheduler,
+	// or the zero time if it never was.
+	LastScheduledRun(jobName string) (time.Time, error)
+	// IsJobRunActive tells whether a job run is queued or running.
+	IsJobRunActive(jobName string, id int) (bool, error)
+	// Runs returns a page of the runs matching the query, without their output.
+	Runs(q RunQuery) (RunPage, error)
+	// JobNames returns the names of all jobs that have runs.
+	JobNames() ([]string, error)
+	// Stats summarizes the finished runs of a job since a point in time,
+	// an empty job name summarizes the runs of all jobs.
+	Stats(jobName string, since time.Time) (RunStats, error)
+	// Search returns the runs of which the output matches the query, newest first.
+	Search(q SearchQuery) ([]SearchResult, error)
+	// PruneJobRuns deletes the runs of a job that fall outside of the retention.
+	PruneJobRuns(jobName string, r Retention, now time.Time) (int64, error)
+	// WriteCoreLog stores a log message of cheek itself.
+	WriteCoreLog(e CoreLogEntry) error
+	// CoreLogs returns the core logs matching the query, newest first.
+	CoreLogs(q CoreLogQuery) ([]CoreLogEntry, error)
+	// PruneCoreLogs deletes the core logs that fall outside of the retention.
+	PruneCoreLogs(r CoreLogRetention, now time.Time) (int64, error)
+	Close() error
+}
+
+// Vacuumer is implemented by stores that can return space
+// freed up by pruning to the file system.
+type Vacuumer interface {
+	Vacuum(full bool) error
+}
+
+// NewStore creates a store of the given type, sqlite stores
+// are opened at dbPath.
+func NewStore(storeType string, dbPath string) (Store, error) {
+	switch storeType {
+	case "", StoreSQLite:
+		return OpenSQLiteStore(dbPath)
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store '%s', use one of: %s, %s", storeType, StoreSQLite, StoreMemory)
+	}
+}
+
+const (
+	// readPoolSize is the number of connections used for reading.
+	readPoolSize = 4
+	// writeQueueSize is the number of writes that can be pending
+	// before submitting another one blocks.
+	writeQueueSize = 1024
+	// writeBatchSize is the maximum number of writes committed
+	// in a single transaction.
+	writeBatchSize = 256
+)
+
+var errStoreClosed = errors.New("store is closed")
+
+// writeOp is a write to the db, done receives its result
+// unless nobody waits for it.
+type writeOp struct {
+	fn   func(tx *sqlx.Tx) error
+	done chan error
+}
+
+// SQLiteStore stores everything in a SQLite db. All writes go through
+// a single writer, which commits pending writes in batches, so writers
+// never contend for the db lock. Reads use a pool of their own.
+type SQLiteStore struct {
+	db   *sqlx.DB
+	read *sqlx.DB
+
+	mu      sync.RWMutex
+	closed  bool
+	writes  chan writeOp
+	stopped chan struct{}
+}
+
+// OpenSQLiteStore opens the db at dbPath, brings its schema up to date
+// and creates a store on it with a separate pool for reads.
+func OpenSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	db, err := OpenDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	read, err := connectReadDB(dbPath)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	read.SetMaxOpenConns(readPoolSize)
+	return newSQLiteStore(db, read), nil
+}
+
+// NewSQLiteStore creates a store on a db that is already migrated. Reads and
+// writes share the db, which is limited to a single connection.
+func NewSQLiteStore(db *sqlx.DB) *SQLiteStore {
+	return newSQLiteStore(db, db)
+}
+
+func newSQLiteStore(db *sqlx.DB, read *sqlx.DB) *SQLiteStore {
+	db.SetMaxOpenConns(1)
+	s := &SQLiteStore{
+		db:      db,
+		read:    read,
+		writes:  make(chan writeOp, writeQueueSize),
+		stopped: make(chan struct{}),
+	}
+	go s.writer()
+	return s
+}
+
+// DB returns the underlying db that is written to.
+func (s *SQLiteStore) DB() *sqlx.DB {
+	return s.db
+}
+
+// writer commits the submitted writes until the store gets closed.
+func (s *SQLiteStore) writer() {
+	defer close(s.stopped)
+
+	for op := range s.writes {
+		batch := []writeOp{op}
+	drain:
+		for len(batch) < writeBatchSize {
+			select {
+			case op, ok := <-s.writes:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, op)
+			default:
+				break drain
+			}
+		}
+		s.commit(batch)
+	}
+}
+
+// commit runs a batch of writes in a single transaction, a write that fails
+// only affects itself unless the transaction can't be committed.
+func (s *SQLiteStore) commit(batch []writeOp) {
+	errs := make([]error, len(batch))
+	err := inTx(s.db, func(tx *sqlx.Tx) error {
+		for i, op := range batch {
+			errs[i] = op.fn(tx)
+		}
+		return nil
+	})
+
+	for i, op := range batch {
+		if op.done == nil {
+			continue
+		}
+		if err != nil {
+			op.done <- fmt.Errorf("commit: %w", err)
+		} else {
+			op.done <- errs[i]
+		}
+	}
+}
+
+// submit queues a write for the writer.
+func (s *SQLiteStore) submit(op writeOp) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errStoreClosed
+	}
+	s.writes <- op
+	return nil
+}
+
+// write submits a write and waits until it is committed.
+func (s *SQLiteStore) write(fn func(tx *sqlx.Tx) error) error {
+	done := make(chan error, 1)
+	if err := s.submit(writeOp{fn: fn, done: done}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// Flush waits until all writes submitted before have been committed.
+func (s *SQLiteStore) Flush() error {
+	return s.write(func(*sqlx.Tx) error { return nil })
+}
+
+func (s *SQLiteStore) SaveJobRun(jr *JobRun) error {
+	return s.write(func(tx *sqlx.Tx) error { return InsertOrUpdateJobRun(tx, jr) })
+}
+
+func (s *SQLiteStore) AppendLogLines(lines []LogLine) error {
+	return s.write(func(tx *sqlx.Tx) error {
+		if err := insertLogLines(tx, lines); err != nil {
+			return fmt.Errorf("insert log lines: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) LogLines(jobRunID int, afterLineNumber int) ([]LogLine, error) {
+	return GetLogLines(s.read, jobRunID, afterLineNumber)
+}
+
+func (s *SQLiteStore) JobRun(jobName string, id int) (JobRun, error) {
+	jr, err := LoadJobRun(s.read, jobName, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return jr, ErrJobRunNotFound
+	}
+	return jr, err
+}
+
+func (s *SQLiteStore) JobRuns(jobName string, nruns int, includeLogs bool) ([]JobRun, error) {
+	return LoadJobRuns(s.read, jobName, nruns, includeLogs)
+}
+
+func (s *SQLiteStore) LastScheduledRun(jobName string) (time.Time, error) {
+	return LoadLastScheduledRun(s.read, jobName)
+}
+
+func (s *SQLiteStore) IsJobRunActive(jobName string, id int) (bool, error) {
+	active, err := IsJobRunActive(s.read, jobName, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrJobRunNotFound
+	}
+	return active, err
+}
+
+func (s *SQLiteStore) Runs(q RunQuery) (RunPage, error) {
+	return LoadRuns(s.read, q)
+}
+
+func (s *SQLiteStore) JobNames() ([]string, error) {
+	var jobs []string
+	if err := s.read.Select(&jobs, "SELECT DISTINCT job FROM log ORDER BY job"); err != nil {
+		return nil, fmt.Errorf("load jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (s *SQLiteStore) Stats(jobName string, since time.Time) (RunStats, error) {
+	query := `
+		SELECT triggered_at, status, COALESCE(duration, 0) AS duration FROM log
+		WHERE status IS NOT NULL AND julianday(triggered_at) >= julianday(?)`
+	args := []any{since.UTC().Format(time.RFC3339Nano)}
+	if jobName != "" {
+		query += " AND job = ?"
+		args = append(args, jobName)
+	}
+	query += " ORDER BY julianday(triggered_at), id"
+
+	var jrs []JobRun
+	if err := s.read.Select(&jrs, query, args...); err != nil {
+		return RunStats{}, fmt.Errorf("load stats: %w", err)
+	}
+	st := summarize(jrs)
+
+	all, err := s.history(jobName)
+	if err != nil {
+		return RunStats{}, fmt.Errorf("load stats: %w", err)
+	}
+	st.setHistory(jobName, all)
+	return st, nil
+}
+
+// history looks up when the last success and failure of a job, or of all
+// jobs, happened and how many runs failed since, regardless of when.
+func (s *SQLiteStore) history(jobName string) (RunStats, error) {
+	var st RunStats
+	cond, args := "", []any{}
+	if jobName != "" {
+		cond, args = " AND job = ?", append(args, jobName)
+	}
+	failed := fmt.Sprintf("status IS NOT NULL AND status NOT IN (%d, %d, %d)", StatusOK, StatusSkipped, StatusCancelled)
+
+	latest := func(statusCond string) (*time.Time, error) {
+		var jrs []JobRun
+		query := "SELECT triggered_at FROM log WHERE " + statusCond + cond + " ORDER BY julianday(triggered_at) DESC, id DESC LIMIT 1"
+		if err := s.read.Select(&jrs, query, args...); err != nil || len(jrs) == 0 {
+			return nil, err
+		}
+		return &jrs[0].TriggeredAt, nil
+	}
+	var err error
+	if st.LastSuccess, err = latest(fmt.Sprintf("status = %d", StatusOK)); err != nil {
+		return st, err
+	}
+	if st.LastFailure, err = latest(failed); err != nil {
+		return st, err
+	}
+
+	query := "SELECT COUNT(*) FROM log WHERE " + failed + cond
+	if st.LastSuccess != nil {
+		query += " AND julianday(triggered_at) > julianday(?)"
+		args = append(args, st.LastSuccess.UTC().Format(time.RFC3339Nano))
+	}
+	err = s.read.Get(&st.FailureStreak, query, args...)
+	return st, err
+}
+
+func (s *SQLiteStore) Search(q SearchQuery) ([]SearchResult, error) {
+	return SearchRuns(s.read, q)
+}
+
+func (s *SQLiteStore) PruneJobRuns(jobName string, r Retention, now time.Time) (n int64, err error) {
+	err = s.write(func(tx *sqlx.Tx) error {
+		n, err = pruneLog(tx, jobName, r.KeepRuns, cutoff(r.KeepDays, now))
+		return err
+	})
+	return n, err
+}
+
+// WriteCoreLog queues the message for the writer without waiting for it to
+// be committed, consecutive core logs end up being written in batches.
+func (s *SQLiteStore) WriteCoreLog(e CoreLogEntry) error {
+	return s.submit(writeOp{fn: func(tx *sqlx.Tx) error { return insertCoreLogs(tx, []CoreLogEntry{e}) }})
+}
+
+func (s *SQLiteStore) CoreLogs(q CoreLogQuery) ([]CoreLogEntry, error) {
+	return LoadCoreLogs(s.read, q)
+}
+
+func (s *SQLiteStore) PruneCoreLogs(r CoreLogRetention, now time.Time) (n int64, err error) {
+	err = s.write(func(tx *sqlx.Tx) error {
+		n, err = pruneCoreLog(tx, r.KeepLines, cutoff(r.KeepDays, now))
+		return err
+	})
+	return n, err
+}
+
+func (s *SQLiteStore) Vacuum(full bool) error {
+	return VacuumDB(s.db, full)
+}
+
+// Close commits the pending writes and closes the db.
+func (s *SQLiteStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.writes)
+	s.mu.Unlock()
+
+	<-s.stopped
+	if s.read != s.db {
+		_ = s.read.Close()
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,290 @@
+package cheek
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stores returns a fresh instance of every store implementation.
+func stores(t *testing.T) map[string]Store {
+	db := setupTestDB(t)
+	t.Cleanup(func() { _ = db.Close() })
+	return map[string]Store{
+		StoreSQLite: NewSQLiteStore(db),
+		StoreMemory: NewMemoryStore(),
+	}
+}
+
+func TestStoreJobRuns(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			ok, failed := StatusOK, StatusError
+
+			first := &JobRun{Name: "job", TriggeredAt: now.Add(-2 * time.Hour), TriggeredBy: "cron", Status: &ok, Log: "first"}
+			assert.NoError(t, store.SaveJobRun(first))
+			assert.NotZero(t, first.LogEntryId)
+
+			second := &JobRun{Name: "job", TriggeredAt: now.Add(-time.Hour), TriggeredBy: "ui"}
+			assert.NoError(t, store.SaveJobRun(second))
+			active, err := store.IsJobRunActive("job", second.LogEntryId)
+			assert.NoError(t, err)
+			assert.True(t, active)
+
+			// saving again updates the run
+			id := second.LogEntryId
+			second.Status, second.Log = &failed, "second"
+			assert.NoError(t, store.SaveJobRun(second))
+			assert.Equal(t, id, second.LogEntryId)
+			active, err = store.IsJobRunActive("job", id)
+			assert.NoError(t, err)
+			assert.False(t, active)
+
+			assert.NoError(t, store.SaveJobRun(&JobRun{Name: "other", TriggeredAt: now, TriggeredBy: "cron", Status: &ok}))
+
+			jrs, err := store.JobRuns("job", 10, false)
+			assert.NoError(t, err)
+			assert.Len(t, jrs, 2)
+			assert.Equal(t, id, jrs[0].LogEntryId)
+			assert.Empty(t, jrs[0].Log)
+
+			jrs, err = store.JobRuns("job", 1, true)
+			assert.NoError(t, err)
+			assert.Len(t, jrs, 1)
+			assert.Equal(t, "second", jrs[0].Log)
+
+			jr, err := store.JobRun("job", -1)
+			assert.NoError(t, err)
+			assert.Equal(t, id, jr.LogEntryId)
+			jr, err = store.JobRun("job", first.LogEntryId)
+			assert.NoError(t, err)
+			assert.Equal(t, "first", jr.Log)
+			_, err = store.JobRun("job", 4242)
+			assert.ErrorIs(t, err, ErrJobRunNotFound)
+			_, err = store.IsJobRunActive("job", 4242)
+			assert.ErrorIs(t, err, ErrJobRunNotFound)
+
+			last, err := store.LastScheduledRun("job")
+			assert.NoError(t, err)
+			assert.True(t, first.TriggeredAt.Equal(last))
+			last, err = store.LastScheduledRun("never")
+			assert.NoError(t, err)
+			assert.True(t, last.IsZero())
+
+			jobs, err := store.JobNames()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"job", "other"}, jobs)
+
+			st, err := store.Stats("job", time.Time{})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, st.Runs)
+			assert.Equal(t, 1, st.Succeeded)
+			assert.Equal(t, 1, st.Failed)
+			assert.True(t, first.TriggeredAt.Equal(*st.LastSuccess))
+			assert.True(t, second.TriggeredAt.Equal(*st.LastFailure))
+			st, err = store.Stats("", now.Add(-90*time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, 2, st.Runs)
+
+			n, err := store.PruneJobRuns("job", Retention{KeepRuns: 1}, now)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+			jrs, err = store.JobRuns("job", 10, false)
+			assert.NoError(t, err)
+			assert.Len(t, jrs, 1)
+		})
+	}
+}
+
+func TestStoreLogLines(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			jr := &JobRun{Name: "job", TriggeredAt: time.Now(), TriggeredBy: "cron"}
+			assert.NoError(t, store.SaveJobRun(jr))
+			assert.NoError(t, store.AppendLogLines([]LogLine{
+				{JobRunID: jr.LogEntryId, LineNumber: 1, Content: "one", Stream: StreamStdout},
+				{JobRunID: jr.LogEntryId, LineNumber: 2, Content: "two", Stream: StreamStderr},
+			}))
+			assert.NoError(t, store.AppendLogLines([]LogLine{
+				{JobRunID: jr.LogEntryId, LineNumber: 3, Content: "three", Stream: StreamStdout},
+			}))
+
+			lines, err := store.LogLines(jr.LogEntryId, 1)
+			assert.NoError(t, err)
+			assert.Len(t, lines, 2)
+			assert.Equal(t, "two", lines[0].Content)
+			assert.Equal(t, StreamStderr, lines[0].Stream)
+			assert.Equal(t, "three", lines[1].Content)
+
+			// log lines go together with their run
+			status := StatusOK
+			jr.Status = &status
+			assert.NoError(t, store.SaveJobRun(jr))
+			_, err = store.PruneJobRuns("job", Retention{KeepDays: 1}, time.Now().Add(72*time.Hour))
+			assert.NoError(t, err)
+			lines, err = store.LogLines(jr.LogEntryId, 0)
+			assert.NoError(t, err)
+			assert.Empty(t, lines)
+		})
+	}
+}
+
+func TestStoreCoreLogs(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			log := NewLogger("info", store)
+			log.Info().Msg("first")
+			log.Info().Msg("second")
+			log.Debug().Msg("not logged")
+			// core logs are written in the background
+			if s, ok := store.(*SQLiteStore); ok {
+				assert.NoError(t, s.Flush())
+			}
+
+			logs, err := store.CoreLogs(CoreLogQuery{})
+			assert.NoError(t, err)
+			assert.Len(t, logs, 2)
+			assert.Equal(t, "second", logs[0].Message)
+
+			n, err := store.PruneCoreLogs(CoreLogRetention{KeepLines: 1}, time.Now())
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+
+			// core logs aren't runs of a job
+			jobs, err := store.JobNames()
+			assert.NoError(t, err)
+			assert.Empty(t, jobs)
+		})
+	}
+}
+
+func TestSQLiteStoreCloseFlushesCoreLogs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "cheek.sqlite3")
+	store, err := NewStore(StoreSQLite, dbPath)
+	assert.NoError(t, err)
+	assert.NoError(t, store.WriteCoreLog(CoreLogEntry{Time: time.Now(), Level: "info", Message: "queued"}))
+	// core logs that are still queued get written on close
+	assert.NoError(t, store.Close())
+
+	store, err = NewStore(StoreSQLite, dbPath)
+	assert.NoError(t, err)
+	defer func() { _ = store.Close() }()
+	logs, err := store.CoreLogs(CoreLogQuery{})
+	assert.NoError(t, err)
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, "queued", logs[0].Message)
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	store, err := NewStore(StoreMemory, "")
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, store)
+
+	_, err = NewStore("cassandra", "")
+	assert.Error(t, err)
+}
+
+func TestMemoryStoreSchedule(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SuppressLogs = true
+	cfg.Store = NewMemoryStore()
+
+	j := &JobSpec{Name: "test", Command: []string{"echo", "hello"}, cfg: cfg}
+	jr := j.execCommandWithRetry("test")
+	assert.Equal(t, StatusOK, *jr.Status)
+
+	j.loadRuns(10, true)
+	assert.Len(t, j.Runs, 1)
+	assert.Contains(t, j.Runs[0].Log, "hello")
+
+	lines, err := cfg.Store.LogLines(jr.LogEntryId, 0)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 1)
+	assert.Equal(t, "hello", lines[0].Content)
+}
+
+// runJobs simulates n jobs that run at the same time, each saving its
+// run, some output lines and a core log.
+func runJobs(store Store, n int) error {
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			jr := &JobRun{Name: fmt.Sprintf("job%d", i%10), TriggeredAt: time.Now(), TriggeredBy: fmt.Sprintf("bench%d", i)}
+			if err := store.SaveJobRun(jr); err != nil {
+				errs <- err
+				return
+			}
+			var lines []LogLine
+			for l := 1; l <= 10; l++ {
+				lines = append(lines, LogLine{JobRunID: jr.LogEntryId, LineNumber: l, Content: "output", Stream: StreamStdout})
+			}
+			if err := store.AppendLogLines(lines); err != nil {
+				errs <- err
+				return
+			}
+			if err := store.WriteCoreLog(CoreLogEntry{Time: time.Now(), Level: "info", Job: jr.Name, Message: "Job triggered"}); err != nil {
+				errs <- err
+				return
+			}
+			status := StatusOK
+			jr.Status = &status
+			if err := store.SaveJobRun(jr); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := store.JobRuns(jr.Name, 10, false); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+func TestSQLiteStoreConcurrentJobs(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "cheek.sqlite3")
+	store, err := OpenSQLiteStore(fn)
+	assert.NoError(t, err)
+
+	var mode string
+	assert.NoError(t, store.read.Get(&mode, "PRAGMA journal_mode"))
+	assert.Equal(t, "wal", mode)
+
+	assert.NoError(t, runJobs(store, 100))
+	assert.NoError(t, store.Close())
+
+	db, err := ConnectDB(fn)
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, 100, countRows(t, db, "SELECT COUNT(*) FROM log"))
+	assert.Equal(t, 100, countRows(t, db, "SELECT COUNT(*) FROM core_log"))
+	assert.Equal(t, 1000, countRows(t, db, "SELECT COUNT(*) FROM log_lines"))
+
+	// writes after closing fail instead of blocking
+	assert.ErrorIs(t, store.WriteCoreLog(CoreLogEntry{Message: "late"}), errStoreClosed)
+}
+
+func BenchmarkSQLiteStoreConcurrentJobs(b *testing.B) {
+	store, err := OpenSQLiteStore(filepath.Join(b.TempDir(), "cheek.sqlite3"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := runJobs(store, 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
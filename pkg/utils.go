@@ -6,15 +6,15 @@ import (
 	"io"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog"
 	"github.com/spf13/viper"
 )
 
-const jobNameCoreProcess = "_cheek"
-
 type tsBuffer struct {
 	b bytes.Buffer
 	m sync.Mutex
@@ -51,7 +51,21 @@ type Config struct {
 	HomeDir      string `yaml:"homedir"`
 	Port         string `yaml:"port"`
 	DBPath       string `yaml:"dbpath"`
-	DB           *sqlx.DB
+	StoreType    string `yaml:"storeType"`
+	Store        Store
+	// Bind is the address the HTTP server listens on, all interfaces if empty
+	Bind string `yaml:"bind"`
+	// TLSCert and TLSKey make the HTTP server serve HTTPS, TLSClientCA
+	// makes it require client certificates signed by the CA
+	TLSCert     string `yaml:"tlsCert"`
+	TLSKey      string `yaml:"tlsKey"`
+	TLSClientCA string `yaml:"tlsClientCA"`
+	// Socket is a Unix domain socket for the HTTP server to listen on
+	// instead of a TCP port, created with the permissions of SocketMode
+	Socket     string `yaml:"socket"`
+	SocketMode string `yaml:"socketMode"`
+	// BasePath is the path prefix the UI and API are served under
+	BasePath string `yaml:"basePath"`
 }
 
 func NewConfig() Config {
@@ -62,14 +76,16 @@ func NewConfig() Config {
 		HomeDir:      CheekPath(),
 		Port:         "8081",
 		DBPath:       path.Join(CheekPath(), "cheek.sqlite3"),
+		StoreType:    StoreSQLite,
+		SocketMode:   defaultSocketMode,
 	}
 }
 
 func (c *Config) Init() error {
 	var err error
-	c.DB, err = OpenDB(c.DBPath)
+	c.Store, err = NewStore(c.StoreType, c.DBPath)
 	if err != nil {
-		return fmt.Errorf("open db: %w", err)
+		return fmt.Errorf("open store: %w", err)
 	}
 	return nil
 }
@@ -93,30 +109,29 @@ func PrettyStdout() io.Writer {
 	return zerolog.ConsoleWriter{Out: os.Stdout}
 }
 
-type DBLogWriter struct {
-	db *sqlx.DB
+type StoreLogWriter struct {
+	store Store
 }
 
-func (w DBLogWriter) Write(p []byte) (n int, err error) {
-	_, err = w.db.Exec("INSERT INTO log (job, message) VALUES (?, ?)", jobNameCoreProcess, string(p))
-	if err != nil {
+func (w StoreLogWriter) Write(p []byte) (n int, err error) {
+	if err := w.store.WriteCoreLog(parseCoreLog(p)); err != nil {
 		return 0, err
 	}
 	return len(p), nil
 }
 
-func NewDBLogWriter(db *sqlx.DB) io.Writer {
-	return DBLogWriter{db: db}
+func NewStoreLogWriter(store Store) io.Writer {
+	return StoreLogWriter{store: store}
 }
 
 // Configures the package's global logger, also allows to pass in custom writers for
 // testing purposes.
-func NewLogger(logLevel string, db *sqlx.DB, extraWriters ...io.Writer) zerolog.Logger {
+func NewLogger(logLevel string, store Store, extraWriters ...io.Writer) zerolog.Logger {
 	var multi zerolog.LevelWriter
 
 	var loggers []io.Writer
-	if db != nil {
-		loggers = append(loggers, NewDBLogWriter(db))
+	if store != nil {
+		loggers = append(loggers, NewStoreLogWriter(store))
 	}
 	loggers = append(loggers, extraWriters...)
 
@@ -129,10 +144,36 @@ func NewLogger(logLevel string, db *sqlx.DB, extraWriters ...io.Writer) zerolog.
 	return zerolog.New(multi).With().Timestamp().Logger().Level(level)
 }
 
-func getCoreLogsFromDB(db *sqlx.DB, nruns int) ([]JobRun, error) {
-	var logs []JobRun
-	if err := db.Select(&logs, "SELECT triggered_at, message FROM log WHERE job = ? ORDER BY id DESC LIMIT ?", jobNameCoreProcess, nruns); err != nil {
-		return nil, err
+// ParseWindow parses a duration that can also be given in days, such as 7d.
+func ParseWindow(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("can't parse '%s' as a number of days", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("can't parse '%s' as a duration", v)
+	}
+	return d, nil
+}
+
+// ParseTime parses a time given as RFC 3339, as a date or as a
+// duration before now, such as 7d or 12h.
+func ParseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := ParseWindow(v); err == nil {
+		return time.Now().Add(-d), nil
 	}
-	return logs, nil
+	return time.Time{}, fmt.Errorf("can't parse '%s' as a time", v)
 }
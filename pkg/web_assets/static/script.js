@@ -4,37 +4,126 @@ document.addEventListener('alpine:init', () => {
     jobName: null,
     jobRun: null,
     runId: null,
+    waitingFor: null,
+    following: false,
+    eventSource: null,
+    stats: null,
+    statsWindow: '7d',
+    trend: [],
+    paramValues: {},
 
     fetchSpec: async function () {
       try {
-        const response = await fetch(`/api/jobs/${this.jobName}`);
+        const response = await fetch(`${basePath}/api/jobs/${this.jobName}`);
         if (!response.ok) {
           throw new Error('Network response was not ok');
         }
         this.spec = await response.json();
+        // fill the trigger form with the defaults, keeping what was entered
+        for (const param of this.spec.params || []) {
+          if (!(param.name in this.paramValues)) {
+            this.paramValues[param.name] = param.type === 'bool' ? param.default === 'true' : (param.default || '');
+          }
+        }
       } catch (error) {
         console.error('Fetch error:', error);
       }
     },
+    paramInputType: function (param) {
+      return { int: 'number', date: 'date' }[param.type] || 'text';
+    },
+    formatParams: function (params) {
+      return Object.entries(params || {}).map(([name, value]) => `${name}=${value}`).join(', ');
+    },
+    fetchStats: async function () {
+      // the trend shows the durations of the latest finished runs in the window
+      const runsParams = new URLSearchParams({ since: this.statsWindow, status: 'success,failed,timeout', sort: '-triggered_at', limit: 100 });
+      try {
+        const [stats, runs] = await Promise.all([
+          fetch(`${basePath}/api/jobs/${this.jobName}/stats?window=${this.statsWindow}`),
+          fetch(`${basePath}/api/jobs/${this.jobName}/runs?${runsParams}`),
+        ]);
+        if (!stats.ok || !runs.ok) {
+          throw new Error('Network response was not ok');
+        }
+        this.stats = await stats.json();
+        this.trend = (await runs.json()).runs.reverse();
+      } catch (error) {
+        console.error('Fetch error:', error);
+      }
+    },
+    successRateClass: function () {
+      const rate = this.stats ? this.stats.success_rate : 0;
+      return rate >= 0.95 ? 'text-emerald-600' : (rate >= 0.8 ? 'text-amber-600' : 'text-red-600');
+    },
+    // trendPoints scales the durations of the trend to a chart, the longest run reaches the top
+    trendPoints: function (width, height) {
+      const longest = Math.max(1, ...this.trend.map(run => run.duration || 0));
+      const step = this.trend.length > 1 ? width / (this.trend.length - 1) : 0;
+      return this.trend.map((run, i) => `${i * step},${height - (run.duration || 0) / longest * height}`).join(' ');
+    },
     fetchJobRun: async function (runId) {
       try {
-        const response = await fetch(`/api/jobs/${this.jobName}/runs/${runId}`);
+        const response = await fetch(`${basePath}/api/jobs/${this.jobName}/runs/${runId}`);
         if (!response.ok) {
           throw new Error('Network response was not ok');
         }
         this.jobRun = await response.json();
         this.runId = this.jobRun.id // update runId to the actual runId
+        this.waitingFor = this.jobRun.queued ? await this.fetchWaitingFor(this.runId) : null;
+        if (this.jobRun.status === undefined) {
+          this.follow();
+        }
       } catch (error) {
         console.error('Fetch error:', error);
       }
     },
+    follow: function () {
+      // stream the output of a run that is still going, the
+      // browser resumes from the last line when reconnecting
+      this.unfollow();
+      this.jobRun.log = '';
+      this.following = true;
+      const source = new EventSource(`${basePath}/api/jobs/${this.jobName}/runs/${this.runId}/stream`);
+      source.addEventListener('line', (event) => {
+        const line = JSON.parse(event.data);
+        this.jobRun.log += line.content + '\n';
+      });
+      source.addEventListener('done', () => {
+        this.unfollow();
+        this.fetchSpec();
+        this.fetchStats();
+        this.fetchJobRun(this.runId);
+      });
+      this.eventSource = source;
+    },
+    unfollow: function () {
+      if (this.eventSource) {
+        this.eventSource.close();
+        this.eventSource = null;
+      }
+      this.following = false;
+    },
+    fetchWaitingFor: async function (runId) {
+      // queued runs wait for a free worker, for a slot in a concurrency group
+      // or for the previous run of their job
+      const response = await fetch(`${basePath}/api/schedule/queue`);
+      if (!response.ok) {
+        throw new Error('Network response was not ok');
+      }
+      const queue = await response.json();
+      const queues = [queue, ...Object.values(queue.groups || {}), ...Object.values(queue.jobs || {})];
+      const run = queues.flatMap(q => q.runs || []).find(r => r.id === runId);
+      return run ? (run.waiting_for || 'a free worker') : null;
+    },
     async init() {
       // get jobname from last part of url
-      const { jobName, runId } = parseJobUrl(window.location.href);
+      const { jobName, runId } = parseJobUrl(window.location.pathname);
       this.jobName = jobName;
       this.runId = runId === "latest" ? -1 : runId;
 
       this.fetchSpec();
+      this.fetchStats();
       this.fetchJobRun(this.runId)
     }
 
@@ -47,7 +136,7 @@ document.addEventListener('alpine:init', () => {
 
     fetchJobs: async function () {
       try {
-        const response = await fetch('/api/jobs/');
+        const response = await fetch(`${basePath}/api/jobs`);
         if (!response.ok) {
           throw new Error('Network response was not ok');
         }
@@ -81,7 +170,7 @@ document.addEventListener('alpine:init', () => {
 
     fetchVersion: async function () {
       try {
-        const response = await fetch('/api/version');
+        const response = await fetch(`${basePath}/api/version`);
         if (!response.ok) {
           throw new Error('Network response was not ok');
         }
@@ -97,21 +186,93 @@ document.addEventListener('alpine:init', () => {
     }
   })
 
+  // alpine data component
+  Alpine.data('search', () => ({
+
+    results: null,
+    error: null,
+    filters: { q: '', job: '', since: '' },
+    fetchResults: async function () {
+      const params = new URLSearchParams();
+      for (const [key, value] of Object.entries(this.filters)) {
+        if (value) params.set(key, value);
+      }
+      try {
+        const response = await fetch(`${basePath}/api/search?${params}`);
+        const data = await response.json();
+        if (!response.ok) {
+          throw new Error(data.status || 'Network response was not ok');
+        }
+        this.results = data;
+        this.error = null;
+      } catch (error) {
+        this.results = null;
+        this.error = error.message;
+      }
+    },
+    // submit keeps the search in the url, so it can be shared
+    submit() {
+      const params = new URLSearchParams();
+      for (const [key, value] of Object.entries(this.filters)) {
+        if (value) params.set(key, value);
+      }
+      history.replaceState(null, '', `${basePath}/search?${params}`);
+      this.fetchResults();
+    },
+    init() {
+      const params = new URLSearchParams(window.location.search);
+      for (const key of Object.keys(this.filters)) {
+        this.filters[key] = params.get(key) || '';
+      }
+      if (this.filters.q) this.fetchResults();
+    }
+
+  }))
+
   // alpine data component
   Alpine.data('coreLogs', () => ({
 
     logs: null,
-    fetchLogs: async function () {
+    more: false,
+    pageSize: 120,
+    filters: { level: '', job: '', q: '', since: '', until: '' },
+    // fetchLogs loads the logs matching the filters, or the
+    // page of logs after the ones already loaded
+    fetchLogs: async function (next = false) {
+      const params = new URLSearchParams({ limit: this.pageSize });
+      for (const [key, value] of Object.entries(this.filters)) {
+        if (!value) continue;
+        // datetime-local inputs hold the browser's local time
+        const isTime = key === 'since' || key === 'until';
+        params.set(key, isTime ? new Date(value).toISOString() : value);
+      }
+      if (next && this.logs && this.logs.length > 0) {
+        params.set('before', this.logs[this.logs.length - 1].id);
+      }
       try {
-        const response = await fetch('/api/core/logs');
+        const response = await fetch(`${basePath}/api/core/logs?${params}`);
         if (!response.ok) {
           throw new Error('Network response was not ok');
         }
-        this.logs = await response.json();
+        const page = await response.json();
+        this.logs = next ? this.logs.concat(page) : page;
+        this.more = page.length === this.pageSize;
       } catch (error) {
         console.error('Fetch error:', error);
       }
     },
+    levelClass(level) {
+      switch (level) {
+        case 'debug': case 'trace': return 'text-gray-400';
+        case 'warn': return 'text-amber-600';
+        case 'error': case 'fatal': case 'panic': return 'text-red-600';
+        default: return 'text-slate-800';
+      }
+    },
+    formatFields(fields) {
+      if (!fields) return '';
+      return Object.entries(fields).map(([k, v]) => `${k}=${typeof v === 'string' ? v : JSON.stringify(v)}`).join(' ');
+    },
     init() {
       this.fetchLogs();
     }
@@ -123,22 +284,42 @@ document.addEventListener('alpine:init', () => {
 })
 
 
-function triggerJob(jobName) {
-  fetch(`/api/jobs/${jobName}/trigger`, {
+// triggerJob resolves to the id of the triggered run, the params are
+// sent as a JSON object and the error of the server is thrown as is
+async function triggerJob(jobName, params) {
+  const init = { method: 'POST' };
+  if (params && Object.keys(params).length > 0) {
+    init.headers = { 'Content-Type': 'application/json' };
+    init.body = JSON.stringify(params);
+  }
+  const response = await fetch(`${basePath}/api/jobs/${jobName}/trigger`, init);
+  const body = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    console.error(`Job ${jobName} could not be triggered!`);
+    throw new Error(body.status || 'error: could not trigger');
+  }
+  console.log(`Job ${jobName} triggered!`);
+  return body.run_id;
+}
+
+// cancelRun stops a queued or executing run, the error of the server is thrown as is
+async function cancelRun(jobName, runId) {
+  const response = await fetch(`${basePath}/api/jobs/${jobName}/runs/${runId}/cancel`, {
     method: 'POST',
-  }).then(response => {
-    if (response.ok) {
-      console.log(`Job ${jobName} triggered!`);
-    } else {
-      console.error(`Job ${jobName} could not be triggered!`);
-    }
   });
+  if (!response.ok) {
+    const body = await response.json().catch(() => ({}));
+    console.error(`Run ${runId} of job ${jobName} could not be cancelled!`);
+    throw new Error(body.status || 'error: could not cancel');
+  }
+  console.log(`Run ${runId} of job ${jobName} cancelled!`);
 }
 
-function parseJobUrl(url) {
-  // Using a regular expression to extract jobName and runId
-  const regex = /\/jobs\/([^\/]+)\/([^\/]+)/;
-  const match = url.match(regex);
+function parseJobUrl(path) {
+  // Using a regular expression to extract jobName and runId,
+  // after the path the UI is served under
+  const regex = /^\/jobs\/([^\/]+)\/([^\/]+)/;
+  const match = path.slice(basePath.length).match(regex);
 
   if (match && match.length >= 3) {
     return {
@@ -160,4 +341,13 @@ function truncateDateTime(dateTimeStr) {
   // Extract the matched part
   const match = dateTimeStr.match(regex);
   return match ? match[1] : null;
-}
\ No newline at end of file
+}
+
+
+function formatDuration(ms) {
+  // durations of runs are in milliseconds
+  if (ms < 1000) return `${ms}ms`;
+  if (ms < 60000) return `${(ms / 1000).toFixed(1)}s`;
+  if (ms < 3600000) return `${(ms / 60000).toFixed(1)}m`;
+  return `${(ms / 3600000).toFixed(1)}h`;
+}